@@ -12,100 +12,575 @@ import (
 // order of the keys.
 type Tree[V any] struct {
 	root node[V]
+	// number of keys in the tree
+	size int
+	// the generation of this tree, nodes with a different generation are shared
+	// with another tree and are copied before they're modified.
+	gen uint64
 }
 
 // Put inserts or updates a value in the tree associated with the provided key. Value can be any
 // interface value, including nil. key can be an arbitrary byte slice, including the empty slice.
 func (a *Tree[V]) Put(key []byte, value V) {
-	a.root = a.put(a.root, key, value)
+	a.root, _, _ = a.put(a.root, key, value, true)
 }
 
-func (a *Tree[V]) put(n node[V], key []byte, value V) node[V] {
+// Swap inserts or updates the value in the tree associated with the provided key, and returns
+// the value that was previously associated with the key. replaced is true if the key previously
+// had a value in the tree, false otherwise.
+func (a *Tree[V]) Swap(key []byte, value V) (old V, replaced bool) {
+	a.root, old, replaced = a.put(a.root, key, value, true)
+	return old, replaced
+}
+
+// LoadOrStore returns the existing value for the key if it has one. Otherwise it stores and
+// returns the supplied value. loaded is true if the value was loaded, false if it was stored.
+func (a *Tree[V]) LoadOrStore(key []byte, value V) (actual V, loaded bool) {
+	a.root, actual, loaded = a.put(a.root, key, value, false)
+	if !loaded {
+		actual = value
+	}
+	return actual, loaded
+}
+
+// Update calls fn with the current value for the key and then stores the value that fn returns,
+// all in a single descent of the tree. exists is false if the key has no value in the tree, in which
+// case old is the zero value. If fn returns false for keep, the key is removed from the tree instead.
+func (a *Tree[V]) Update(key []byte, fn func(old V, exists bool) (new V, keep bool)) {
+	a.root, _ = a.update(a.root, key, fn)
+}
+
+// update returns the updated node, and the change in the number of keys, which is -1 if the
+// key was removed, 1 if it was added, otherwise 0.
+func (a *Tree[V]) update(n node[V], key []byte, fn func(old V, exists bool) (new V, keep bool)) (out node[V], change int) {
+	var old V
+	if n != nil {
+		h := n.header()
+		if bytes.HasPrefix(key, h.path.asSlice()) {
+			rest := key[h.path.len:]
+			if len(rest) == 0 {
+				if vn := n.valueNode(); vn != nil {
+					v, keep := fn(vn.value, true)
+					if keep {
+						return a.replaceValue(n, v), 0
+					}
+					a.size--
+					return a.removeValue(n), -1
+				}
+			} else if next := n.getChildNode(rest); next != nil {
+				c, change := a.update(*next, rest[1:], fn)
+				if c != *next || change != 0 {
+					n = a.writable(n)
+					*n.getChildNode(rest) = c
+					n.addSize(change)
+				}
+				if change >= 0 {
+					return n, change
+				}
+				if c == nil {
+					n.removeChild(rest[0])
+				}
+				return n.shrink(), change
+			}
+		}
+	}
+	// there's no existing value for key
+	v, keep := fn(old, false)
+	if !keep {
+		return n, 0
+	}
+	n, _, _ = a.put(n, key, v, true)
+	return n, 1
+}
+
+// CompareAndSwap stores new as the value for key if the current value for key is equal to old. It
+// returns true if the value was swapped. Unlike the other operations this is a function rather than a
+// method as it requires the value type to be comparable.
+func CompareAndSwap[V comparable](a *Tree[V], key []byte, old, new V) (swapped bool) {
+	a.Update(key, func(current V, exists bool) (V, bool) {
+		if exists && current == old {
+			swapped = true
+			return new, true
+		}
+		return current, exists
+	})
+	return swapped
+}
+
+// CompareAndDelete deletes the value for key if it is equal to old. It returns true if the value
+// was deleted.
+func CompareAndDelete[V comparable](a *Tree[V], key []byte, old V) (deleted bool) {
+	a.Update(key, func(current V, exists bool) (V, bool) {
+		if exists && current == old {
+			deleted = true
+			return current, false
+		}
+		return current, exists
+	})
+	return deleted
+}
+
+// put will store the value at key, if there is an existing value for the key, then it's
+// returned and the value is only updated if replace is set.
+func (a *Tree[V]) put(n node[V], key []byte, value V, replace bool) (out node[V], old V, exists bool) {
 	if n == nil {
-		return newPathLeaf(key, value)
+		a.size++
+		return newPathLeaf(a.gen, key, value), old, false
 	}
-	key, n = splitNodePath(key, n)
-	if len(key) == 0 {
-		vn := n.valueNode()
-		if vn != nil {
-			vn.value = value
-		} else if n.canSetNodeValue() {
-			n.setNodeValue(newLeaf(value))
+	path := n.keyPath().asSlice()
+	prefixLen := prefixSize(key, path)
+	if prefixLen < len(path) {
+		// the key diverges part way through n's path, so n moves under a new node4
+		// that holds the common part of the path.
+		a.size++
+		parent := splitNodePath(n, prefixLen, a.gen)
+		if key = key[prefixLen:]; len(key) == 0 {
+			parent.setNodeValue(newLeaf(value))
 		} else {
+			parent.addChildNode(key[0], newPathLeaf(a.gen, key[1:], value))
+		}
+		return parent, old, false
+	}
+	key = key[prefixLen:]
+	if len(key) == 0 {
+		if vn := n.valueNode(); vn != nil {
+			old = vn.value
+			if replace {
+				n = a.replaceValue(n, value)
+			}
+			return n, old, true
+		}
+		a.size++
+		n = a.writable(n)
+		if !n.canSetNodeValue() {
 			n = n.grow()
-			n.setNodeValue(newLeaf(value))
 		}
-		return n
+		n.setNodeValue(newLeaf(value))
+		return n, old, false
+	}
+	if child := n.getChildNode(key); child != nil {
+		c, old, exists := a.put(*child, key[1:], value, replace)
+		if c != *child || !exists {
+			n = a.writable(n)
+			*n.getChildNode(key) = c
+			if !exists {
+				n.addSize(1)
+			}
+		}
+		return n, old, exists
 	}
-	child := n.getChildNode(key)
-	if child != nil {
-		*child = a.put(*child, key[1:], value)
+	a.size++
+	if n.canAddChild() {
+		n = a.writable(n)
+	} else {
+		n = a.grow(n)
+	}
+	n.addChildNode(key[0], newPathLeaf(a.gen, key[1:], value))
+	return n, old, false
+}
+
+// writable returns n if it belongs to this tree's generation, otherwise it returns
+// a copy of n that does and so can be modified.
+func (a *Tree[V]) writable(n node[V]) node[V] {
+	return writableBy(n, a.gen)
+}
+
+// writableBy returns n if it belongs to generation gen, otherwise a copy of n that does.
+// Leaves don't have a generation, they belong to generation 0, which is the generation of
+// trees that have never shared their nodes. Trees with any other generation copy leaves.
+func writableBy[V any](n node[V], gen uint64) node[V] {
+	if n.header().gen == gen {
 		return n
 	}
-	if !n.canAddChild() {
-		n = n.grow()
+	return n.clone(gen)
+}
+
+// grow returns a larger node than n, with the same contents, that belongs to this tree's
+// generation.
+func (a *Tree[V]) grow(n node[V]) node[V] {
+	if l, isLeaf := n.(*leaf[V]); isLeaf {
+		return l.promote(a.gen)
+	}
+	return a.writable(n).grow()
+}
+
+// replaceValue returns n with its existing value replaced by value.
+func (a *Tree[V]) replaceValue(n node[V], value V) node[V] {
+	n = a.writable(n)
+	l := n.valueNode()
+	if node[V](l) != n {
+		// the value is in a separate leaf, which may be shared even if n isn't.
+		l = a.writable(l).(*leaf[V])
+		n.setNodeValue(l)
 	}
-	n.addChildNode(key[0], newPathLeaf(key[1:], value))
+	l.value = value
 	return n
 }
 
+// removeValue returns n without its value, which may be a different node or nil.
+func (a *Tree[V]) removeValue(n node[V]) node[V] {
+	if _, isLeaf := n.(*leaf[V]); isLeaf {
+		return nil
+	}
+	return a.writable(n).removeValue()
+}
+
 // Get the value for the provided key. exists is true if the key contains a value in the tree,
 // false otherwise. The exists flag can be useful if you are storing nil values in the tree.
 func (a *Tree[V]) Get(key []byte) (value V, exists bool) {
-	var zero V
+	if leaf := a.getLeaf(key); leaf != nil {
+		return leaf.value, true
+	}
+	return value, false
+}
+
+// getLeaf returns the leaf that holds the value for key, or nil if key isn't in the tree.
+func (a *Tree[V]) getLeaf(key []byte) *leaf[V] {
 	if a.root == nil {
-		return zero, false
+		return nil
 	}
 	curr := a.root
 	for {
-		h := curr.header()
-		if !bytes.HasPrefix(key, h.path.asSlice()) {
-			return zero, false
+		// keyPath avoids copying the whole header, as only the path is needed.
+		path := curr.keyPath()
+		if !bytes.HasPrefix(key, path.asSlice()) {
+			return nil
 		}
-		key = key[h.path.len:]
+		key = key[path.len:]
 		if len(key) == 0 {
-			leaf := curr.valueNode()
-			if leaf != nil {
-				return leaf.value, true
-			}
-			return zero, false
+			return curr.valueNode()
 		}
 		next := curr.getChildNode(key)
 		if next == nil {
-			return zero, false
+			return nil
 		}
 		curr = *next
 		key = key[1:]
 	}
 }
 
+// Min returns the smallest key in the tree along with its value. ok is false if the tree is empty.
+func (a *Tree[V]) Min() (key []byte, value V, ok bool) {
+	if a.root == nil {
+		return nil, value, false
+	}
+	// not nil, so that the empty key is distinguishable from no key
+	key = make([]byte, 0, 16)
+	curr := a.root
+	for curr != nil {
+		h := curr.header()
+		key = append(key, h.path.asSlice()...)
+		if h.hasValue {
+			return key, curr.valueNode().value, true
+		}
+		k, child := nextChild(curr, 0)
+		key = append(key, k)
+		curr = child
+	}
+	return nil, value, false
+}
+
+// Max returns the largest key in the tree along with its value. ok is false if the tree is empty.
+func (a *Tree[V]) Max() (key []byte, value V, ok bool) {
+	if a.root == nil {
+		return nil, value, false
+	}
+	// not nil, so that the empty key is distinguishable from no key
+	key = make([]byte, 0, 16)
+	curr := a.root
+	for curr != nil {
+		h := curr.header()
+		key = append(key, h.path.asSlice()...)
+		k, child := prevChild(curr, 256)
+		if child == nil {
+			if h.hasValue {
+				return key, curr.valueNode().value, true
+			}
+			break
+		}
+		key = append(key, k)
+		curr = child
+	}
+	return nil, value, false
+}
+
+// Ceiling returns the smallest key in the tree that is equal to or greater than key, along with its
+// value. ok is false if there is no such key.
+func (a *Tree[V]) Ceiling(key []byte) (ceilingKey []byte, value V, ok bool) {
+	it := a.SeekIterator(key)
+	return copyCurrent(it)
+}
+
+// Successor returns the smallest key in the tree that is greater than key, along with its value.
+// ok is false if there is no such key.
+func (a *Tree[V]) Successor(key []byte) (successorKey []byte, value V, ok bool) {
+	it := a.SeekIterator(key)
+	if it.Valid() && bytes.Equal(it.Key(), key) {
+		it.Next()
+	}
+	return copyCurrent(it)
+}
+
+func copyCurrent[V any](it *Iterator[V]) (key []byte, value V, ok bool) {
+	if !it.Valid() {
+		return nil, value, false
+	}
+	return copyKey(it.Key()), it.Value(), true
+}
+
+// copyKey returns a copy of k. Like Min and Max, the copy of the empty key is an empty slice
+// rather than nil, so that it's distinguishable from no key.
+func copyKey(k []byte) []byte {
+	return append([]byte{}, k...)
+}
+
+// Floor returns the largest key in the tree that is equal to or less than key, along with its value.
+// ok is false if there is no such key.
+func (a *Tree[V]) Floor(key []byte) (floorKey []byte, value V, ok bool) {
+	// key + 0x00 is the smallest key that is greater than key
+	end := make([]byte, len(key)+1)
+	copy(end, key)
+	return a.lastBefore(end)
+}
+
+// Predecessor returns the largest key in the tree that is less than key, along with its value.
+// ok is false if there is no such key.
+func (a *Tree[V]) Predecessor(key []byte) (predecessorKey []byte, value V, ok bool) {
+	if len(key) == 0 {
+		// nothing is less than the empty key, and an empty end to lastBefore means no limit.
+		return nil, value, false
+	}
+	return a.lastBefore(key)
+}
+
+// lastBefore returns the largest key that is less than end.
+func (a *Tree[V]) lastBefore(end []byte) (key []byte, value V, ok bool) {
+	a.WalkRangeReverse(nil, end, func(k []byte, v V) WalkState {
+		key, value, ok = copyKey(k), v, true
+		return Stop
+	})
+	return key, value, ok
+}
+
+// LongestPrefix returns the longest key in the tree that is a prefix of the supplied key, along
+// with its value. ok is false if there is no key in the tree that is a prefix of key. The returned
+// matchedKey is a sub-slice of key, or an empty slice if key is nil and matches the empty key.
+func (a *Tree[V]) LongestPrefix(key []byte) (matchedKey []byte, value V, ok bool) {
+	if key == nil {
+		key = []byte{}
+	}
+	a.prefixesOf(key, func(depth int, l *leaf[V]) WalkState {
+		matchedKey, value, ok = key[:depth], l.value, true
+		return Continue
+	})
+	return matchedKey, value, ok
+}
+
+// WalkPrefixesOf will call the provided callback function with each key/value pair whose key is
+// a prefix of the supplied key, from the shortest to the longest. The key passed to the callback
+// is a sub-slice of the supplied key. The callback return value can be used to continue or stop the walk
+func (a *Tree[V]) WalkPrefixesOf(key []byte, callback func(key []byte, value V) WalkState) {
+	if key == nil {
+		key = []byte{}
+	}
+	a.prefixesOf(key, func(depth int, l *leaf[V]) WalkState {
+		return callback(key[:depth], l.value)
+	})
+}
+
+// prefixesOf follows the path of key through the tree, calling the callback with the length
+// of the prefix and the value leaf for each node that has a value along the way.
+func (a *Tree[V]) prefixesOf(key []byte, callback func(depth int, l *leaf[V]) WalkState) {
+	depth := 0
+	curr := a.root
+	for curr != nil {
+		h := curr.header()
+		if !bytes.HasPrefix(key[depth:], h.path.asSlice()) {
+			return
+		}
+		depth += int(h.path.len)
+		if h.hasValue {
+			if callback(depth, curr.valueNode()) == Stop {
+				return
+			}
+		}
+		if depth == len(key) {
+			return
+		}
+		next := curr.getChildNode(key[depth:])
+		if next == nil {
+			return
+		}
+		curr = *next
+		depth++
+	}
+}
+
 // Delete removes the value associated with the supplied key if it exists. Its okay to
 // call Delete with a key that doesn't exist.
 func (a *Tree[V]) Delete(key []byte) {
+	a.LoadAndDelete(key)
+}
+
+// LoadAndDelete removes the value associated with the supplied key if it exists, and returns
+// the removed value. deleted is true if the key had a value in the tree, false otherwise.
+func (a *Tree[V]) LoadAndDelete(key []byte) (old V, deleted bool) {
 	if a.root == nil {
-		return
+		return old, false
 	}
-	a.root = a.delete(a.root, key)
+	a.root, old, deleted = a.delete(a.root, key)
+	return old, deleted
 }
 
-func (a *Tree[V]) delete(n node[V], key []byte) node[V] {
+func (a *Tree[V]) delete(n node[V], key []byte) (out node[V], old V, deleted bool) {
 	h := n.header()
 	if !bytes.HasPrefix(key, h.path.asSlice()) {
-		return n
+		return n, old, false
 	}
 	key = key[h.path.len:]
 	if len(key) == 0 {
-		return n.removeValue()
+		if !h.hasValue {
+			return n, old, false
+		}
+		a.size--
+		old = n.valueNode().value
+		return a.removeValue(n), old, true
 	}
 	next := n.getChildNode(key)
 	if next == nil {
-		return n
+		return n, old, false
+	}
+	c, old, deleted := a.delete(*next, key[1:])
+	if !deleted {
+		return n, old, false
 	}
-	*next = a.delete(*next, key[1:])
-	if *next == nil {
+	n = a.writable(n)
+	*n.getChildNode(key) = c
+	n.addSize(-1)
+	if c == nil {
 		n.removeChild(key[0])
 	}
-	return n.shrink()
+	return n.shrink(), old, true
+}
+
+// DeletePrefix removes all the keys that start with prefix from the tree, and returns the number
+// of keys that were removed. The matching keys are removed by detaching the subtree that contains
+// them, rather than deleting each key individually.
+func (a *Tree[V]) DeletePrefix(prefix []byte) int {
+	if a.root == nil {
+		return 0
+	}
+	var removed int
+	a.root, removed = a.deletePrefix(a.root, prefix)
+	a.size -= removed
+	return removed
+}
+
+func (a *Tree[V]) deletePrefix(n node[V], prefix []byte) (out node[V], removed int) {
+	h := n.header()
+	path := h.path.asSlice()
+	prefixLen := prefixSize(prefix, path)
+	if prefixLen == len(prefix) {
+		// every key in this node starts with prefix, this includes when the prefix
+		// ends part way through the compressed path.
+		return nil, sizeOf(n)
+	}
+	if prefixLen < len(path) {
+		return n, 0
+	}
+	prefix = prefix[len(path):]
+	next := n.getChildNode(prefix)
+	if next == nil {
+		return n, 0
+	}
+	c, removed := a.deletePrefix(*next, prefix[1:])
+	if removed == 0 {
+		return n, 0
+	}
+	n = a.writable(n)
+	*n.getChildNode(prefix) = c
+	n.addSize(-removed)
+	if c == nil {
+		n.removeChild(prefix[0])
+	}
+	return n.shrink(), removed
+}
+
+// DeleteRange removes all the keys that are equal to or greater than start and less than end, and
+// returns the number of keys that were removed. The range is specified in the same way as WalkRange,
+// so nil can be used to mean no limit in that direction. Child nodes that are entirely within the
+// range are removed in one go, rather than deleting each key individually.
+func (a *Tree[V]) DeleteRange(start []byte, end []byte) int {
+	if a.root == nil {
+		return 0
+	}
+	cmpEnd := keyLimit{end, 0}
+	if len(end) == 0 {
+		cmpEnd = keyLimit{end, -1}
+	}
+	var removed int
+	a.root, removed = a.deleteRange(a.root, keyLimit{start, 0}, cmpEnd)
+	a.size -= removed
+	return removed
+}
+
+func (a *Tree[V]) deleteRange(n node[V], start, end keyLimit) (out node[V], removed int) {
+	h := n.header()
+	for _, k := range h.path.asSlice() {
+		start.cmpSegment(k)
+		end.cmpSegment(k)
+	}
+	if end.eqOrGreaterThan() || start.cmp < 0 {
+		// this node is entirely outside the range
+		return n, 0
+	}
+	if start.eqOrGreaterThan() && end.cmp < 0 {
+		// this node is entirely inside the range
+		return nil, sizeOf(n)
+	}
+	// collect the keys first, as the children can't be removed while iterating them.
+	keys := make([]byte, 0, h.childCount)
+	n.iterateChildrenRange(start.minNextKey(), end.stopKey(), func(k byte, _ node[V]) WalkState {
+		keys = append(keys, k)
+		return Continue
+	})
+	for i, k := range keys {
+		nextStart, nextEnd := start, end
+		nextStart.cmpSegment(k)
+		nextEnd.cmpSegment(k)
+		next := n.getChildNode(keys[i:])
+		c, childRemoved := a.deleteRange(*next, nextStart, nextEnd)
+		if childRemoved == 0 {
+			continue
+		}
+		n = a.writable(n)
+		*n.getChildNode(keys[i:]) = c
+		n.addSize(-childRemoved)
+		if c == nil {
+			n.removeChild(k)
+		}
+		removed += childRemoved
+	}
+	if start.eqOrGreaterThan() && h.hasValue {
+		n = a.removeValue(n)
+		removed++
+	}
+	if removed == 0 {
+		return n, 0
+	}
+	return shrinkAll(n), removed
+}
+
+// shrinkAll repeatedly shrinks n until it is the smallest node type that can hold its contents.
+func shrinkAll[V any](n node[V]) node[V] {
+	for n != nil {
+		s := n.shrink()
+		if s == n {
+			return n
+		}
+		n = s
+	}
+	return nil
 }
 
 // WalkState describes how to proceed with an iteration of the tree (or partial tree).
@@ -190,6 +665,102 @@ func (a *Tree[V]) walkStart(n node[V], current []byte, start, end keyLimit, call
 	})
 }
 
+// WalkPrefix will call the provided callback function with each key/value pair whose key
+// starts with prefix, in key order. The callback return value can be used to continue or stop the walk
+func (a *Tree[V]) WalkPrefix(prefix []byte, callback func(key []byte, value V) WalkState) {
+	current := make([]byte, 0, 32)
+	n := a.root
+	for n != nil {
+		h := n.header()
+		path := h.path.asSlice()
+		prefixLen := prefixSize(prefix, path)
+		if prefixLen == len(prefix) {
+			// everything in this node starts with prefix
+			a.walk(n, current, callback)
+			return
+		}
+		if prefixLen < len(path) {
+			return
+		}
+		prefix = prefix[len(path):]
+		next := n.getChildNode(prefix)
+		if next == nil {
+			return
+		}
+		current = append(append(current, path...), prefix[0])
+		prefix = prefix[1:]
+		n = *next
+	}
+}
+
+// WalkReverse will call the provided callback function with each key/value pair, in reverse key order.
+// The callback return value can be used to continue or stop the walk
+func (a *Tree[V]) WalkReverse(callback func(key []byte, value V) WalkState) {
+	if a.root == nil {
+		return
+	}
+	a.walkReverse(a.root, make([]byte, 0, 32), callback)
+}
+
+func (a *Tree[V]) walkReverse(n node[V], prefix []byte, callback func(key []byte, value V) WalkState) WalkState {
+	h := n.header()
+	prefix = append(prefix, h.path.asSlice()...)
+	if n.iterateChildrenRangeReverse(0, 256, func(k byte, cn node[V]) WalkState {
+		return a.walkReverse(cn, append(prefix, k), callback)
+	}) == Stop {
+		return Stop
+	}
+	if h.hasValue {
+		return callback(prefix, n.valueNode().value)
+	}
+	return Continue
+}
+
+// WalkRangeReverse will call the provided callback function with each key/value pair, in reverse
+// key order. It selects the same keys as WalkRange, so keys will be limited to those equal to or
+// greater than start and less than end, and nil can be used to mean no limit in that direction.
+// e.g. WalkRangeReverse(nil, []byte{2}, cb) will walk all keys less than [2], starting with the
+// largest. The callback return value can be used to continue or stop the walk
+func (a *Tree[V]) WalkRangeReverse(start []byte, end []byte, callback func(key []byte, value V) WalkState) {
+	if a.root == nil {
+		return
+	}
+	cmpEnd := keyLimit{end, 0}
+	if len(end) == 0 {
+		cmpEnd = keyLimit{end, -1}
+	}
+	a.walkStartReverse(a.root, make([]byte, 0, 32), keyLimit{start, 0}, cmpEnd, callback)
+}
+
+func (a *Tree[V]) walkStartReverse(n node[V], current []byte, start, end keyLimit, callback func(key []byte, value V) WalkState) WalkState {
+	h := n.header()
+	for _, k := range h.path.asSlice() {
+		start.cmpSegment(k)
+		end.cmpSegment(k)
+	}
+	if end.eqOrGreaterThan() {
+		// this node is after end, but there may be earlier nodes that are in range.
+		return Continue
+	}
+	if start.cmp < 0 {
+		// this node and everything still to be walked is before start.
+		return Stop
+	}
+	current = append(current, h.path.asSlice()...)
+	if n.iterateChildrenRangeReverse(start.minNextKey(), end.stopKey(), func(k byte, cn node[V]) WalkState {
+		nextStart, nextEnd := start, end
+		nextStart.cmpSegment(k)
+		nextEnd.cmpSegment(k)
+		return a.walkStartReverse(cn, append(current, k), nextStart, nextEnd, callback)
+	}) == Stop {
+		return Stop
+	}
+	if start.eqOrGreaterThan() && h.hasValue {
+		return callback(current, n.valueNode().value)
+	}
+	return Continue
+}
+
 type keyLimit struct {
 	path []byte
 	cmp  int
@@ -247,6 +818,11 @@ func (a *Tree[V]) PrettyPrint(w io.Writer) {
 	bw.Flush()
 }
 
+// Len returns the number of keys in the tree.
+func (a *Tree[V]) Len() int {
+	return a.size
+}
+
 // Stats contains counts of items in the tree
 type Stats struct {
 	Node4s   int
@@ -284,6 +860,8 @@ type node[V any] interface {
 	iterateChildren(cb func(k byte, n node[V]) WalkState) WalkState
 	// iterateChildrenRange a potential subset of children where start >= key < end
 	iterateChildrenRange(start, end int, cb func(k byte, n node[V]) WalkState) WalkState
+	// iterateChildrenRangeReverse is the same as iterateChildrenRange but in descending key order
+	iterateChildrenRangeReverse(start, end int, cb func(k byte, n node[V]) WalkState) WalkState
 
 	canSetNodeValue() bool
 	setNodeValue(n *leaf[V])
@@ -295,9 +873,14 @@ type node[V any] interface {
 	// a smaller type)
 	removeValue() node[V]
 	removeChild(key byte)
+	// addSize adjusts the number of keys below the node by delta. This is needed when one of
+	// its children is replaced by one with a different number of keys.
+	addSize(delta int)
 
 	grow() node[V]
 	shrink() node[V]
+	// clone returns a shallow copy of the node that belongs to the generation gen.
+	clone(gen uint64) node[V]
 
 	pretty(indent int, dest writer)
 	stats(s *Stats)
@@ -310,27 +893,43 @@ type nodeHeader struct {
 	// how/where the value is kept is node type dependent. node4/16/48 keep
 	// it in the last child, and have 1 less max children
 	hasValue bool
+	// the number of keys in this node and all the nodes below it, so that a whole subtree can be
+	// removed without walking it. A tree with more than 4 billion keys would need more memory than
+	// is likely to be available, so this fits in what would otherwise be padding.
+	size uint32
 	// additional key values to this node (for path compression, lazy expansion)
 	path keyPath
+	// the generation of the tree that created this node. Nodes from another generation
+	// may be shared with other trees, and are copied before being modified.
+	gen uint64
 }
 
-// splitNodePath will if needed split the supplied node into 2 based on the
-// overlap of the key and the nodes compressed path. If the key and the path are the
-// same then there's no need to split and the node is returned unaltered.
-func splitNodePath[V any](key []byte, n node[V]) (remainingKey []byte, out node[V]) {
-	h := n.header()
-	path := h.path.asSlice()
-	prefixLen := prefixSize(key, path)
-	if prefixLen < len(path) {
-		// need to split into 2
-		parent := &node4[V]{}
-		parent.path.assign(path[:prefixLen])
-		parent.addChildNode(path[prefixLen], n)
-		// +1 because we consumed a byte for the child key
-		n.keyPath().trimPathStart(prefixLen + 1)
-		return key[prefixLen:], parent
-	}
-	return key[prefixLen:], n
+func (h *nodeHeader) addSize(delta int) {
+	h.size = uint32(int(h.size) + delta)
+}
+
+// sizeOf returns the number of keys in n and the nodes below it.
+func sizeOf[V any](n node[V]) int {
+	if n == nil {
+		return 0
+	}
+	return int(n.header().size)
+}
+
+// splitNodePath splits n after the first prefixLen bytes of its path. The returned node4
+// has those bytes as its path, and n, with the rest of its path, as its only child. n is
+// copied first if it doesn't belong to generation gen, and the new node4 belongs to gen.
+func splitNodePath[V any](n node[V], prefixLen int, gen uint64) *node4[V] {
+	path := n.keyPath().asSlice()
+	parent := &node4[V]{}
+	parent.gen = gen
+	parent.path.assign(path[:prefixLen])
+	k := path[prefixLen]
+	n = writableBy(n, gen)
+	// +1 because we consumed a byte for the child key
+	n.keyPath().trimPathStart(prefixLen + 1)
+	parent.addChildNode(k, n)
+	return parent
 }
 
 func writePath(p []byte, w io.Writer) {
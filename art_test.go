@@ -35,6 +35,33 @@ func Test_OverwriteWithSameKey(t *testing.T) {
 	}, &Stats{Node4s: 1, Keys: 2})
 }
 
+func Test_OverwriteDoesntAllocate(t *testing.T) {
+	a := new(Tree[int])
+	keys := benchKeys(100)
+	for i, k := range keys {
+		a.Put(k, i)
+	}
+	a.Put(nil, 0)
+	a.Put(keys[0][:4], 0)
+	i := 0
+	if allocs := testing.AllocsPerRun(10, func() {
+		for _, k := range keys {
+			a.Put(k, i)
+		}
+		a.Put(nil, i)
+		a.Swap(keys[0][:4], i)
+		a.Update(keys[1], func(v int, _ bool) (int, bool) { return v + 1, true })
+		i++
+	}); allocs != 0 {
+		t.Errorf("Overwriting values in a tree that's never been shared should not allocate, but got %v allocations", allocs)
+	}
+	// once it's been shared, the leaves are copied rather than changed.
+	a.Snapshot()
+	if allocs := testing.AllocsPerRun(10, func() { a.Put(keys[0], i) }); allocs == 0 {
+		t.Errorf("Overwriting values in a shared tree should copy the leaf")
+	}
+}
+
 func Test_InsertOnLeaf(t *testing.T) {
 	testArt(t, []keyVal[string]{
 		kvs("123", "abc"),
@@ -191,6 +218,259 @@ func Test_GrowWithPrefixValue(t *testing.T) {
 	testArt(t, keyVals, &Stats{Node256s: 1, Node4s: 1, Keys: 259})
 }
 
+func Test_Len(t *testing.T) {
+	a := new(Tree[int])
+	exp := kvStore[int]{}
+	for i := 0; i < 4; i++ {
+		a.Put([]byte{1, byte(i)}, i)
+		exp.put(kv([]byte{1, byte(i)}, i))
+	}
+	a.Put([]byte{1, 2}, 22)
+	exp.put(kv([]byte{1, 2}, 22))
+	if a.Len() != 4 {
+		t.Errorf("Len() should be 4 after overwriting an existing key, but was %d", a.Len())
+	}
+	// [1] is the path to a full node4 without a value
+	a.Delete([]byte{1})
+	a.Delete([]byte{1, 5})
+	a.Delete([]byte{2})
+	hasKeyVals(t, a, exp.ordered())
+	a.Delete([]byte{1, 0})
+	exp.delete([]byte{1, 0})
+	hasKeyVals(t, a, exp.ordered())
+}
+
+func Test_SwapLoadOrStoreAndLoadAndDelete(t *testing.T) {
+	a := new(Tree[int])
+	s := kvStore[int]{}
+	keys := make([][]byte, 200)
+	for i := range keys {
+		keys[i] = rndKey()
+	}
+	for i := 0; i < 2000; i++ {
+		k := keys[rnd.Intn(len(keys))]
+		exp, expExists := s.get(k)
+		if rnd.Intn(3) == 0 {
+			old, deleted := a.LoadAndDelete(k)
+			s.delete(k)
+			if deleted != expExists || old != exp {
+				t.Fatalf("LoadAndDelete(%v) returned %d, %t but expecting %d, %t", k, old, deleted, exp, expExists)
+			}
+		} else if rnd.Intn(2) == 0 {
+			act, loaded := a.LoadOrStore(k, i)
+			if !expExists {
+				s.put(kv(k, i))
+				exp = i
+			}
+			if loaded != expExists || act != exp {
+				t.Fatalf("LoadOrStore(%v) returned %d, %t but expecting %d, %t", k, act, loaded, exp, expExists)
+			}
+		} else {
+			old, replaced := a.Swap(k, i)
+			s.put(kv(k, i))
+			if replaced != expExists || old != exp {
+				t.Fatalf("Swap(%v) returned %d, %t but expecting %d, %t", k, old, replaced, exp, expExists)
+			}
+		}
+	}
+	hasKeyVals(t, a, s.ordered())
+}
+
+func Test_Update(t *testing.T) {
+	a := new(Tree[int])
+	s := kvStore[int]{}
+	keys := make([][]byte, 200)
+	for i := range keys {
+		keys[i] = rndKey()
+	}
+	for i := 0; i < 3000; i++ {
+		k := keys[rnd.Intn(len(keys))]
+		exp, expExists := s.get(k)
+		calls := 0
+		a.Update(k, func(old int, exists bool) (int, bool) {
+			calls++
+			if exists != expExists || old != exp {
+				t.Fatalf("Update(%v) called with %d, %t but expecting %d, %t", k, old, exists, exp, expExists)
+			}
+			// delete every 5th, otherwise increment.
+			if old%5 == 4 {
+				s.delete(k)
+				return 0, false
+			}
+			s.put(kv(k, old+1))
+			return old + 1, true
+		})
+		if calls != 1 {
+			t.Fatalf("Update(%v) expected to call fn once, but called it %d times", k, calls)
+		}
+		if a.Len() != len(s.kvs) {
+			t.Fatalf("Len() is %d but expecting %d", a.Len(), len(s.kvs))
+		}
+	}
+	hasKeyVals(t, a, s.ordered())
+	t.Run("absent and not kept", func(t *testing.T) {
+		b := new(Tree[int])
+		b.Put([]byte{1, 2, 3, 4}, 1)
+		before := pretty(b)
+		for _, k := range [][]byte{{1, 2}, {1, 2, 3, 4, 5}, {1, 3}, {2}, nil} {
+			b.Update(k, func(old int, exists bool) (int, bool) {
+				return 0, false
+			})
+		}
+		if after := pretty(b); after != before || b.Len() != 1 {
+			t.Errorf("Update that doesn't keep an absent key shouldn't change the tree\nbefore\n%s\nafter\n%s", before, after)
+		}
+	})
+}
+
+func Test_CompareAndSwap(t *testing.T) {
+	a := new(Tree[string])
+	k := []byte("key")
+	if CompareAndSwap(a, k, "", "one") {
+		t.Errorf("CompareAndSwap on a missing key should fail")
+	}
+	if a.Len() != 0 {
+		t.Errorf("CompareAndSwap on a missing key shouldn't add it")
+	}
+	a.Put(k, "one")
+	if CompareAndSwap(a, k, "two", "three") {
+		t.Errorf("CompareAndSwap with the wrong old value should fail")
+	}
+	if !CompareAndSwap(a, k, "one", "two") {
+		t.Errorf("CompareAndSwap with the correct old value should succeed")
+	}
+	hasKeyVals(t, a, []keyVal[string]{kvs("key", "two")})
+}
+
+func Test_CompareAndDelete(t *testing.T) {
+	a := new(Tree[string])
+	k := []byte("key")
+	if CompareAndDelete(a, k, "") {
+		t.Errorf("CompareAndDelete on a missing key should fail")
+	}
+	a.Put(k, "one")
+	a.Put([]byte("keys"), "other")
+	if CompareAndDelete(a, k, "two") {
+		t.Errorf("CompareAndDelete with the wrong old value should fail")
+	}
+	hasKeyVals(t, a, []keyVal[string]{kvs("key", "one"), kvs("keys", "other")})
+	if !CompareAndDelete(a, k, "one") {
+		t.Errorf("CompareAndDelete with the correct old value should succeed")
+	}
+	hasKeyVals(t, a, []keyVal[string]{kvs("keys", "other")})
+}
+
+func Test_DeletePrefix(t *testing.T) {
+	build := func() (*Tree[int], *kvStore[int]) {
+		a := new(Tree[int])
+		s := &kvStore[int]{}
+		for i := 0; i < 300; i++ {
+			e := kv([]byte{byte(i % 7), byte(i % 3), 1, 2, 3, byte(i)}, i)
+			a.Put(e.key, e.val)
+			s.put(e)
+		}
+		for _, k := range [][]byte{nil, {1}, {1, 1}, {1, 1, 1}, {2, 2, 1, 2}, {6, 0xFF}} {
+			e := kv(k, len(k))
+			a.Put(e.key, e.val)
+			s.put(e)
+		}
+		return a, s
+	}
+	prefixes := [][]byte{
+		nil, {1}, {1, 1}, {1, 1, 1}, {1, 1, 1, 2}, {1, 1, 1, 2, 3}, {1, 1, 1, 2, 3, 1}, {1, 1, 1, 2, 3, 1, 0},
+		{1, 1, 2}, {2, 2, 1, 2}, {6}, {6, 0xFF}, {7},
+	}
+	for _, p := range prefixes {
+		t.Run(hexPath(p), func(t *testing.T) {
+			a, s := build()
+			expRemoved := 0
+			for _, e := range append([]keyVal[int](nil), s.kvs...) {
+				if bytes.HasPrefix(e.key, p) {
+					s.delete(e.key)
+					expRemoved++
+				}
+			}
+			removed := a.DeletePrefix(p)
+			if removed != expRemoved {
+				t.Errorf("DeletePrefix(%v) removed %d keys, but expecting %d", p, removed, expRemoved)
+			}
+			hasKeyVals(t, a, s.ordered())
+			if st := a.Stats(); st.Keys != a.Len() {
+				t.Errorf("Stats() reports %d keys, but Len() is %d", st.Keys, a.Len())
+			}
+		})
+	}
+}
+
+func Test_DeleteRange(t *testing.T) {
+	build := func() (*Tree[int], *kvStore[int]) {
+		a := new(Tree[int])
+		s := &kvStore[int]{}
+		for i := 0; i < 1000; i++ {
+			e := kv([]byte{byte(i % 3), byte(i / 5), 1, 2, 3, byte(i)}, i)
+			a.Put(e.key, e.val)
+			s.put(e)
+		}
+		for _, k := range [][]byte{nil, {1}, {1, 1}, {1, 1, 1}, {2, 2, 1, 2}, {2, 0xFF}} {
+			e := kv(k, len(k))
+			a.Put(e.key, e.val)
+			s.put(e)
+		}
+		return a, s
+	}
+	cases := []keyRange{
+		{nil, nil},
+		{nil, []byte{1}},
+		{[]byte{1}, nil},
+		{[]byte{1}, []byte{2}},
+		{[]byte{1, 1}, []byte{1, 1, 1, 2, 3, 0xFF}},
+		{[]byte{1, 1, 1, 2}, []byte{1, 1, 1, 2, 3, 50}},
+		{[]byte{0, 10}, []byte{2, 100}},
+		{[]byte{0, 10, 1, 2, 3}, []byte{0, 10, 1, 2, 4}},
+		{[]byte{0, 10, 1, 2, 3, 50}, []byte{0, 10, 1, 2, 3, 52}},
+		{[]byte{0, 4}, []byte{0, 190}},
+		{[]byte{2, 0xFF}, nil},
+		{[]byte{3}, []byte{4}},
+		{rndKey(), rndKey()},
+	}
+	for _, tc := range cases {
+		t.Run(tc.String(), func(t *testing.T) {
+			a, s := build()
+			exp := s.orderedRange(tc.start, tc.end)
+			for _, e := range exp {
+				s.delete(e.key)
+			}
+			removed := a.DeleteRange(tc.start, tc.end)
+			if removed != len(exp) {
+				t.Errorf("DeleteRange removed %d keys, but expecting %d", removed, len(exp))
+			}
+			hasKeyVals(t, a, s.ordered())
+			if st := a.Stats(); st.Keys != a.Len() {
+				t.Errorf("Stats() reports %d keys, but Len() is %d", st.Keys, a.Len())
+			}
+			// the tree should still be usable after the range delete
+			for _, e := range exp {
+				a.Put(e.key, e.val)
+				s.put(e)
+			}
+			hasKeyVals(t, a, s.ordered())
+		})
+	}
+}
+
+func Test_DeleteRangeShrinks(t *testing.T) {
+	a := new(Tree[int])
+	for i := 0; i < 256; i++ {
+		a.Put([]byte{1, byte(i)}, i)
+	}
+	a.Put([]byte{1}, 1)
+	a.DeleteRange([]byte{1, 1}, []byte{1, 0xFF})
+	exp := &Stats{Node4s: 1, Keys: 3}
+	if act := a.Stats(); !reflect.DeepEqual(exp, act) {
+		t.Errorf("Unexpected stats of %#v after range delete, expecting %#v", *act, *exp)
+	}
+}
+
 func Test_KeyWithZeros(t *testing.T) {
 	// any arbitrary byte array should be a valid key, even those with embedded nulls.
 	testArt(t, []keyVal[string]{
@@ -218,6 +498,25 @@ func Test_EmptyKey(t *testing.T) {
 	})
 }
 
+func Test_EmptyKeyLookups(t *testing.T) {
+	// lookups that find the empty key return an empty key rather than nil.
+	a := new(Tree[string])
+	s := kvStore[string]{}
+	for _, e := range []keyVal[string]{kv(nil, "k1"), kv([]byte{0}, "k2"), kv([]byte{1, 2}, "k3")} {
+		a.Put(e.key, e.val)
+		s.put(e)
+	}
+	for _, k := range [][]byte{nil, {}, {0}, {0, 0}} {
+		testNeighbours(t, a, &s, k)
+	}
+	a.WalkPrefixesOf(nil, func(k []byte, v string) WalkState {
+		if k == nil {
+			t.Errorf("WalkPrefixesOf(nil) returned a nil key")
+		}
+		return Continue
+	})
+}
+
 func Test_NilValue(t *testing.T) {
 	three := "3"
 	testArt(t, []keyVal[*string]{
@@ -290,6 +589,23 @@ func Test_MoreWalk(t *testing.T) {
 					t.Errorf("Unexpected number of callbacks with early termination, got %d, expecting %d", i, sz-1)
 				}
 			})
+			t.Run("Reverse Walk", func(t *testing.T) {
+				i := sz - 1
+				a.WalkReverse(func(k []byte, v int) WalkState {
+					exp := append(baseK, byte(i))
+					if !bytes.Equal(k, exp) || v != i {
+						t.Errorf("Expecting key/value %v / %d, but got %v / %d", exp, i, k, v)
+					}
+					i--
+					if i < sz/2 {
+						return Stop
+					}
+					return Continue
+				})
+				if i != sz/2-1 {
+					t.Errorf("Unexpected number of callbacks from reverse walk, got %d, expecting %d", sz-1-i, sz-sz/2)
+				}
+			})
 			t.Run("Stop After First Key", func(t *testing.T) {
 				i := 0
 				a.Walk(func(k []byte, v int) WalkState {
@@ -396,7 +712,130 @@ func Test_WalkRange(t *testing.T) {
 	}
 	for _, tc := range cases {
 		testWalkRange(t, a, &s, tc.start, tc.end)
+		testNeighbours(t, a, &s, tc.start)
+		testNeighbours(t, a, &s, tc.end)
+	}
+}
+
+func Test_WalkPrefix(t *testing.T) {
+	a := new(Tree[string])
+	s := kvStore[string]{}
+	keyVals := []keyVal[string]{
+		kv([]byte{2, 3, 4}, "1"),
+		kv([]byte{2, 3, 4, 5, 6, 7, 8}, "2"),
+		kv([]byte{2, 3, 4, 5, 6, 7, 9}, "3"),
+		kv([]byte{2, 0xFF}, "4"),
+		kv([]byte{2, 0xFF, 0xFF, 1}, "5"),
+		kv([]byte{2, 0xFF, 0xFF, 2}, "6"),
+		kv([]byte{3}, "7"),
+	}
+	for _, kv := range keyVals {
+		a.Put(kv.key, kv.val)
+		s.put(kv)
+	}
+	prefixes := [][]byte{
+		nil, {2}, {2, 3}, {2, 3, 4}, {2, 3, 4, 5}, {2, 3, 4, 5, 6, 7}, {2, 3, 4, 5, 6, 7, 9},
+		{2, 3, 4, 5, 6, 7, 9, 1}, {2, 3, 5}, {2, 0xFF}, {2, 0xFF, 0xFF}, {2, 0xFF, 0xFF, 0xFF}, {3}, {4},
+	}
+	for _, p := range prefixes {
+		testWalkPrefix(t, a, &s, p)
+	}
+	t.Run("early stop", func(t *testing.T) {
+		calls := 0
+		a.WalkPrefix([]byte{2}, func(k []byte, v string) WalkState {
+			calls++
+			return Stop
+		})
+		if calls != 1 {
+			t.Errorf("Expecting 1 callback, but got %d", calls)
+		}
+	})
+}
+
+func Test_LongestPrefix(t *testing.T) {
+	a := new(Tree[string])
+	routes := []string{"/", "/org", "/org/team", "/org/team/alice", "/other", "/organic/produce/fruit/apples/and/pears/and/more"}
+	for _, r := range routes {
+		a.Put([]byte(r), r)
+	}
+	cases := []struct {
+		key   string
+		match string
+		ok    bool
+	}{
+		{"", "", false},
+		{"x", "", false},
+		{"/", "/", true},
+		{"/o", "/", true},
+		{"/org", "/org", true},
+		{"/org/", "/org", true},
+		{"/org/tea", "/org", true},
+		{"/org/team", "/org/team", true},
+		{"/org/team/bob", "/org/team", true},
+		{"/org/team/alice/x", "/org/team/alice", true},
+		{"/organic/produce/fruit/apples", "/org", true},
+		{"/organic/produce/fruit/apples/and/pears/and/more/x", "/organic/produce/fruit/apples/and/pears/and/more", true},
+		{"/otherwise", "/other", true},
+	}
+	for _, tc := range cases {
+		t.Run(tc.key, func(t *testing.T) {
+			k, v, ok := a.LongestPrefix([]byte(tc.key))
+			if ok != tc.ok || string(k) != tc.match || v != tc.match {
+				t.Errorf("LongestPrefix(%s) returned %s, %s, %t but expecting %s, %s, %t", tc.key, k, v, ok, tc.match, tc.match, tc.ok)
+			}
+		})
+	}
+	a.Put(nil, "root")
+	if k, v, ok := a.LongestPrefix([]byte("x")); !ok || len(k) != 0 || v != "root" {
+		t.Errorf("LongestPrefix(x) should match the empty key, but got %v, %s, %t", k, v, ok)
+	}
+	if k, v, ok := a.LongestPrefix(nil); !ok || k == nil || len(k) != 0 || v != "root" {
+		t.Errorf("LongestPrefix(nil) should return a non nil empty key, but got %v, %s, %t", k, v, ok)
+	}
+}
+
+func Test_WalkPrefixesOf(t *testing.T) {
+	a := new(Tree[string])
+	rules := []string{"/", "/org", "/org/team", "/org/team/alice", "/other", "/organic/produce/fruit/apples/and/pears/and/more"}
+	for _, r := range rules {
+		a.Put([]byte(r), r)
 	}
+	cases := []struct {
+		key string
+		exp []string
+	}{
+		{"", nil},
+		{"x", nil},
+		{"/", []string{"/"}},
+		{"/org/team/alice/x", []string{"/", "/org", "/org/team", "/org/team/alice"}},
+		{"/org/tea", []string{"/", "/org"}},
+		{"/organic/produce/fruit/apples/and/pears/and/more", []string{"/", "/org", "/organic/produce/fruit/apples/and/pears/and/more"}},
+	}
+	for _, tc := range cases {
+		t.Run(tc.key, func(t *testing.T) {
+			var act []string
+			a.WalkPrefixesOf([]byte(tc.key), func(k []byte, v string) WalkState {
+				if string(k) != v {
+					t.Errorf("key %s has unexpected value %s", k, v)
+				}
+				act = append(act, string(k))
+				return Continue
+			})
+			if !reflect.DeepEqual(act, tc.exp) {
+				t.Errorf("WalkPrefixesOf(%s) returned %v but expecting %v", tc.key, act, tc.exp)
+			}
+		})
+	}
+	t.Run("early stop", func(t *testing.T) {
+		calls := 0
+		a.WalkPrefixesOf([]byte("/org/team"), func(k []byte, v string) WalkState {
+			calls++
+			return Stop
+		})
+		if calls != 1 {
+			t.Errorf("Expecting 1 callback, but got %d", calls)
+		}
+	})
 }
 
 func testArt[V comparable](t *testing.T, inserts []keyVal[V], expectedStats *Stats) {
@@ -450,7 +889,20 @@ func testArtOne[V comparable](t *testing.T, inserts []keyVal[V], deleteOrderer f
 		testWalkRange(t, a, &store, rStart, rEnd)
 		testWalkRange(t, a, &store, rStart[:len(rStart)/2], rEnd[:len(rEnd)/2])
 		testWalkRange(t, a, &store, addBytes(rStart, 0x05), addBytes(rEnd, 0x10))
+		testWalkPrefix(t, a, &store, rStart[:len(rStart)/2])
+		testWalkPrefix(t, a, &store, rEnd)
+		testNeighbours(t, a, &store, rStart)
+		testNeighbours(t, a, &store, rEnd[:len(rEnd)/2])
+		testNeighbours(t, a, &store, append(rEnd, 0))
+		testSeek(t, a, &store, rStart)
+		testSeek(t, a, &store, rEnd[:len(rEnd)/2])
+		testSeek(t, a, &store, addBytes(rStart, 0x05))
+		testSeek(t, a, &store, append(rEnd, 0))
 	}
+	testSeek(t, a, &store, nil)
+	testNeighbours(t, a, &store, nil)
+	testNeighbours(t, a, &store, rndKey())
+	testSeek(t, a, &store, rndKey())
 
 	for i := 0; i < len(inserts)*2+4; i++ {
 		k := rndKey()
@@ -515,12 +967,94 @@ func testWalkRange[V comparable](t *testing.T, a *Tree[V], s *kvStore[V], start,
 		if len(exp) != 0 {
 			t.Errorf("received %d less keys than expected, missing kvs are\n%v", len(exp), kvList(exp))
 		}
+		exp = reverse(s.orderedRange(start, end))
+		a.WalkRangeReverse(start, end, func(k []byte, v V) WalkState {
+			if len(exp) == 0 {
+				t.Errorf("reverse walk received more keys than expecting, additional key/val is %v : %v", k, v)
+				return Stop
+			}
+			if !bytes.Equal(k, exp[0].key) || v != exp[0].val {
+				t.Errorf("reverse walk got key/val %v : %v but expecting %v : %v", k, v, exp[0].key, exp[0].val)
+			}
+			exp = exp[1:]
+			return Continue
+		})
+		if len(exp) != 0 {
+			t.Errorf("reverse walk received %d less keys than expected, missing kvs are\n%v", len(exp), kvList(exp))
+		}
 		if t.Failed() {
 			t.Logf("Tree is \n%v", pretty(a))
 		}
 	})
 }
 
+func testWalkPrefix[V comparable](t *testing.T, a *Tree[V], s *kvStore[V], prefix []byte) {
+	t.Run("prefix "+hexPath(prefix), func(t *testing.T) {
+		exp := []keyVal[V]{}
+		for _, e := range s.ordered() {
+			if bytes.HasPrefix(e.key, prefix) {
+				exp = append(exp, e)
+			}
+		}
+		a.WalkPrefix(prefix, func(k []byte, v V) WalkState {
+			if len(exp) == 0 {
+				t.Errorf("received more keys than expecting, additional key/val is %v : %v", k, v)
+				return Stop
+			}
+			if !bytes.Equal(k, exp[0].key) || v != exp[0].val {
+				t.Errorf("got key/val %v : %v but expecting %v : %v", k, v, exp[0].key, exp[0].val)
+			}
+			exp = exp[1:]
+			return Continue
+		})
+		if len(exp) != 0 {
+			t.Errorf("received %d less keys than expected, missing kvs are\n%v", len(exp), kvList(exp))
+		}
+	})
+}
+
+// testNeighbours verifies the results of Ceiling, Floor, Successor & Predecessor for key.
+func testNeighbours[V comparable](t *testing.T, a *Tree[V], s *kvStore[V], key []byte) {
+	t.Run("neighbours "+hexPath(key), func(t *testing.T) {
+		var ceil, floor, succ, pred *keyVal[V]
+		ordered := s.ordered()
+		for i := range ordered {
+			c := bytes.Compare(ordered[i].key, key)
+			if c <= 0 {
+				floor = &ordered[i]
+			}
+			if c < 0 {
+				pred = &ordered[i]
+			}
+			if c >= 0 && ceil == nil {
+				ceil = &ordered[i]
+			}
+			if c > 0 && succ == nil {
+				succ = &ordered[i]
+			}
+		}
+		check := func(name string, exp *keyVal[V], k []byte, v V, ok bool) {
+			if exp == nil {
+				if ok {
+					t.Errorf("%s(%v) returned %v / %v but expecting no key", name, key, k, v)
+				}
+			} else if !ok || !bytes.Equal(exp.key, k) || exp.val != v {
+				t.Errorf("%s(%v) returned %v / %v / %t but expecting %v / %v", name, key, k, v, ok, exp.key, exp.val)
+			} else if k == nil {
+				t.Errorf("%s(%v) returned a nil key along with ok", name, key)
+			}
+		}
+		k, v, ok := a.Ceiling(key)
+		check("Ceiling", ceil, k, v, ok)
+		k, v, ok = a.Floor(key)
+		check("Floor", floor, k, v, ok)
+		k, v, ok = a.Successor(key)
+		check("Successor", succ, k, v, ok)
+		k, v, ok = a.Predecessor(key)
+		check("Predecessor", pred, k, v, ok)
+	})
+}
+
 func addBytes(v []byte, add byte) []byte {
 	res := append([]byte(nil), v...)
 	idx := len(res) - 1
@@ -575,6 +1109,27 @@ type keyVal[V any] struct {
 	val V
 }
 
+// checkSizes verifies that the size of n and every node below it is the number of keys in them,
+// and returns the number of keys in n.
+func checkSizes[V any](t *testing.T, n node[V]) int {
+	t.Helper()
+	if n == nil {
+		return 0
+	}
+	size := 0
+	if n.header().hasValue {
+		size++
+	}
+	n.iterateChildren(func(_ byte, c node[V]) WalkState {
+		size += checkSizes(t, c)
+		return Continue
+	})
+	if sizeOf(n) != size {
+		t.Errorf("Node with path %v has size %d, but contains %d keys", n.keyPath().asSlice(), sizeOf(n), size)
+	}
+	return size
+}
+
 func kvList[V any](l []keyVal[V]) string {
 	b := &strings.Builder{}
 	for _, x := range l {
@@ -626,6 +1181,57 @@ func hasKeyVals[V comparable](t *testing.T, a *Tree[V], exp []keyVal[V]) {
 	if i < len(exp) {
 		t.Errorf("Expecting %d keys to be walked, but only got %d", len(exp), i)
 	}
+	// and that a reverse walk sees the same keys backwards
+	i = len(exp) - 1
+	a.WalkReverse(func(k []byte, v V) WalkState {
+		if i < 0 {
+			t.Errorf("Got more reverse callbacks than expected, additional k/v is %v / %v", k, v)
+		} else if !bytes.Equal(exp[i].key, k) || v != exp[i].val {
+			t.Errorf("Reverse walk key/value %d was %v / %v but expecting %v / %v", i, k, v, exp[i].key, exp[i].val)
+		}
+		i--
+		return Continue
+	})
+	if i >= 0 {
+		t.Errorf("Expecting %d keys to be reverse walked, but only got %d", len(exp), len(exp)-i-1)
+	}
+	// and that the Iterator sees the same keys
+	i = 0
+	for it := a.Iterator(); it.Valid(); it.Next() {
+		if i >= len(exp) {
+			t.Errorf("Iterator returned more keys than expected, additional k/v is %v / %v", it.Key(), it.Value())
+		} else if !bytes.Equal(exp[i].key, it.Key()) || exp[i].val != it.Value() {
+			t.Errorf("Iterator key/value %d was %v / %v but expecting %v / %v", i, it.Key(), it.Value(), exp[i].key, exp[i].val)
+		}
+		i++
+	}
+	if i < len(exp) {
+		t.Errorf("Expecting %d keys from the Iterator, but only got %d", len(exp), i)
+	}
+	if a.Len() != len(exp) {
+		t.Errorf("Len() returned %d, but expecting %d", a.Len(), len(exp))
+	}
+	if size := checkSizes(t, a.root); size != len(exp) {
+		t.Errorf("The nodes contain %d keys, but expecting %d", size, len(exp))
+	}
+	// check Min & Max agree with the first & last keys
+	minK, minV, minOk := a.Min()
+	maxK, maxV, maxOk := a.Max()
+	if minOk != (len(exp) > 0) || maxOk != (len(exp) > 0) {
+		t.Errorf("Min/Max returned ok %t/%t for a tree with %d keys", minOk, maxOk, len(exp))
+	}
+	if (minOk && minK == nil) || (maxOk && maxK == nil) {
+		t.Errorf("Min/Max returned a nil key along with ok")
+	}
+	if len(exp) > 0 {
+		if !bytes.Equal(minK, exp[0].key) || minV != exp[0].val {
+			t.Errorf("Min() returned %v / %v but expecting %v / %v", minK, minV, exp[0].key, exp[0].val)
+		}
+		last := exp[len(exp)-1]
+		if !bytes.Equal(maxK, last.key) || maxV != last.val {
+			t.Errorf("Max() returned %v / %v but expecting %v / %v", maxK, maxV, last.key, last.val)
+		}
+	}
 	// check that the values are available via the Get fn as well
 	for _, kv := range exp {
 		actual, exists := a.Get(kv.key)
@@ -706,3 +1312,56 @@ func hexPath(p []byte) string {
 	writePath(p, w)
 	return w.String()
 }
+
+func Benchmark_Put(b *testing.B) {
+	keys := benchKeys(100000)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		a := new(Tree[int])
+		for j, k := range keys {
+			a.Put(k, j)
+		}
+	}
+}
+
+func Benchmark_PutOverwrite(b *testing.B) {
+	keys := benchKeys(100000)
+	a := new(Tree[int])
+	for j, k := range keys {
+		a.Put(k, j)
+	}
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		for j, k := range keys {
+			a.Put(k, i+j)
+		}
+	}
+}
+
+func Benchmark_Get(b *testing.B) {
+	keys := benchKeys(100000)
+	a := new(Tree[int])
+	for j, k := range keys {
+		a.Put(k, j)
+	}
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		for _, k := range keys {
+			a.Get(k)
+		}
+	}
+}
+
+// benchKeys returns count random 8 byte keys, the keys are the same for every call.
+func benchKeys(count int) [][]byte {
+	r := rand.New(rand.NewSource(42))
+	keys := make([][]byte, count)
+	for i := range keys {
+		keys[i] = make([]byte, 8)
+		r.Read(keys[i])
+	}
+	return keys
+}
@@ -0,0 +1,151 @@
+package art
+
+import (
+	"bytes"
+	"sort"
+)
+
+// Batch accumulates a set of Put and Delete operations that can then be applied to a Tree
+// in one go with Tree.Apply. Applying a batch sorts the operations by key, so that
+// operations for keys with a shared prefix only descend the shared part of the tree once.
+// If there are multiple operations for the same key, the last one added wins.
+type Batch[V any] struct {
+	ops []batchOp[V]
+}
+
+type batchOp[V any] struct {
+	key    []byte
+	value  V
+	delete bool
+}
+
+// Put adds an operation to the batch to set the value for key. The key is copied, so the
+// caller is free to reuse it once Put returns.
+func (b *Batch[V]) Put(key []byte, value V) {
+	b.ops = append(b.ops, batchOp[V]{key: append([]byte(nil), key...), value: value})
+}
+
+// Delete adds an operation to the batch to delete the value for key. The key is copied, so
+// the caller is free to reuse it once Delete returns.
+func (b *Batch[V]) Delete(key []byte) {
+	b.ops = append(b.ops, batchOp[V]{key: append([]byte(nil), key...), delete: true})
+}
+
+// Len returns the number of operations in the batch.
+func (b *Batch[V]) Len() int {
+	return len(b.ops)
+}
+
+// Reset removes all the operations from the batch.
+func (b *Batch[V]) Reset() {
+	b.ops = b.ops[:0]
+}
+
+// Apply applies all the operations in the batch to the tree. The batch is unchanged and can
+// be applied to other trees.
+func (a *Tree[V]) Apply(b *Batch[V]) {
+	if len(b.ops) == 0 {
+		return
+	}
+	ops := make([]batchOp[V], len(b.ops))
+	copy(ops, b.ops)
+	// stable so that the order of multiple operations for the same key is retained.
+	sort.SliceStable(ops, func(i, j int) bool {
+		return bytes.Compare(ops[i].key, ops[j].key) < 0
+	})
+	// remove all but the last operation for each key, after which the operations are
+	// independent of each other.
+	last := 0
+	for i := 1; i < len(ops); i++ {
+		if !bytes.Equal(ops[i].key, ops[last].key) {
+			last++
+		}
+		ops[last] = ops[i]
+	}
+	a.root = a.apply(a.root, ops[:last+1], 0)
+}
+
+// apply applies the operations to the node n. The operations are sorted by key, and
+// all the keys have the same first depth bytes which lead to n.
+func (a *Tree[V]) apply(n node[V], ops []batchOp[V], depth int) node[V] {
+	// first deal with keys that diverge from n's compressed path. These puts need the node
+	// splitting, while the deletes are for keys that aren't in the tree.
+	matched := ops[:0]
+	for _, op := range ops {
+		key := op.key[depth:]
+		if n != nil {
+			h := n.header()
+			if bytes.HasPrefix(key, h.path.asSlice()) {
+				matched = append(matched, op)
+				continue
+			}
+		}
+		if !op.delete {
+			n, _, _ = a.put(n, key, op.value, true)
+		}
+	}
+	if len(matched) == 0 {
+		return n
+	}
+	// after any splits, n's path is a prefix of all the remaining keys.
+	h := n.header()
+	childDepth := depth + int(h.path.len)
+	var valueOp *batchOp[V]
+	if len(matched[0].key) == childDepth {
+		// the op for the node's own value is sorted first.
+		valueOp = &matched[0]
+		matched = matched[1:]
+	}
+	// removing children is deferred until all the groups are done, as removing children while
+	// adding others could leave a node16 with no children.
+	var removedKeys []byte
+	for len(matched) > 0 {
+		k := matched[0].key[childDepth]
+		end := 1
+		for end < len(matched) && matched[end].key[childDepth] == k {
+			end++
+		}
+		group := matched[:end]
+		matched = matched[end:]
+		next := n.getChildNode(group[0].key[childDepth:])
+		if next == nil {
+			if child := a.apply(nil, group, childDepth+1); child != nil {
+				if n.canAddChild() {
+					n = a.writable(n)
+				} else {
+					n = a.grow(n)
+				}
+				n.addChildNode(k, child)
+			}
+			continue
+		}
+		size := sizeOf(*next)
+		c := a.apply(*next, group, childDepth+1)
+		// the child may have been changed in place, so its size is compared with what it was.
+		if change := sizeOf(c) - size; c != *next || change != 0 {
+			n = a.writable(n)
+			*n.getChildNode(group[0].key[childDepth:]) = c
+			n.addSize(change)
+		}
+		if c == nil {
+			removedKeys = append(removedKeys, k)
+		}
+	}
+	for _, k := range removedKeys {
+		n.removeChild(k)
+	}
+	removed := len(removedKeys) > 0
+	if valueOp != nil {
+		if !valueOp.delete {
+			n, _, _ = a.put(n, valueOp.key[depth:], valueOp.value, true)
+		} else if n.valueNode() != nil {
+			a.size--
+			n = a.removeValue(n)
+			removed = true
+		}
+	}
+	if removed {
+		return shrinkAll(n)
+	}
+	return n
+}
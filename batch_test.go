@@ -0,0 +1,86 @@
+package art
+
+import (
+	"fmt"
+	"testing"
+)
+
+func Test_BatchEmpty(t *testing.T) {
+	a := new(Tree[int])
+	a.Apply(&Batch[int]{})
+	hasKeyVals(t, a, nil)
+	b := Batch[int]{}
+	b.Delete([]byte{1})
+	a.Apply(&b)
+	hasKeyVals(t, a, nil)
+}
+
+func Test_BatchLastOpWins(t *testing.T) {
+	a := new(Tree[string])
+	a.Put([]byte("b"), "b")
+	b := Batch[string]{}
+	b.Put([]byte("a"), "1")
+	b.Put([]byte("a"), "2")
+	b.Delete([]byte("b"))
+	b.Put([]byte("b"), "3")
+	b.Put([]byte("c"), "4")
+	b.Delete([]byte("c"))
+	if b.Len() != 6 {
+		t.Errorf("Batch should have 6 operations but has %d", b.Len())
+	}
+	a.Apply(&b)
+	hasKeyVals(t, a, []keyVal[string]{kvs("a", "2"), kvs("b", "3")})
+	b.Reset()
+	if b.Len() != 0 {
+		t.Errorf("Batch should have no operations after Reset, but has %d", b.Len())
+	}
+}
+
+func Test_BatchKeyCopied(t *testing.T) {
+	a := new(Tree[int])
+	b := Batch[int]{}
+	k := []byte{1, 2}
+	b.Put(k, 12)
+	k[1] = 3
+	b.Put(k, 13)
+	a.Apply(&b)
+	hasKeyVals(t, a, []keyVal[int]{kv([]byte{1, 2}, 12), kv([]byte{1, 3}, 13)})
+}
+
+func Test_BatchApply(t *testing.T) {
+	for _, sz := range []int{1, 5, 20, 100, 1000} {
+		t.Run(fmt.Sprintf("size %d", sz), func(t *testing.T) {
+			a := new(Tree[int])
+			s := kvStore[int]{}
+			keys := make([][]byte, sz)
+			for i := range keys {
+				keys[i] = rndKey()
+				if i%3 == 0 {
+					// keys with a shared prefix, to get nodes with values
+					keys[i] = append([]byte{1, 2, 3}, keys[i][:len(keys[i])/4]...)
+				}
+			}
+			for round := 0; round < 10; round++ {
+				b := Batch[int]{}
+				for i := 0; i < sz; i++ {
+					k := keys[rnd.Intn(len(keys))]
+					if rnd.Intn(round+2) == 0 {
+						b.Put(k, i)
+						s.put(kv(k, i))
+					} else {
+						b.Delete(k)
+						s.delete(k)
+					}
+				}
+				a.Apply(&b)
+				hasKeyVals(t, a, s.ordered())
+				if st := a.Stats(); st.Keys != a.Len() {
+					t.Errorf("Stats() reports %d keys, but Len() is %d", st.Keys, a.Len())
+				}
+				if t.Failed() {
+					t.FailNow()
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,210 @@
+package art
+
+import "errors"
+
+// ErrNotSorted is returned by Builder.Add, FromNext and FromSorted if a key is not greater than the
+// previously added key.
+var ErrNotSorted = errors.New("keys must be added in ascending order without duplicates")
+
+// Builder constructs a new Tree from keys that are supplied in ascending order. As all the
+// children of a node are known before the node is created, each node is created at its final
+// size with its final compressed path. This avoids the repeated grow and path splitting that
+// building the same tree with Put would do.
+//
+//	b := art.Builder[string]{}
+//	for _, kv := range sortedKeyValues {
+//		if err := b.Add(kv.Key, kv.Value); err != nil {
+//			return err
+//		}
+//	}
+//	tree := b.Tree()
+type Builder[V any] struct {
+	// the nodes on the path to the previously added key, these are still being built. Only
+	// stack[:depth] is in use, the remainder is kept to avoid reallocating the keys & children
+	// slices for every node.
+	stack []buildFrame[V]
+	depth int
+	prev  []byte
+	size  int
+}
+
+// buildFrame holds the state of a node that is under construction. As the nodes on the stack
+// are all on the path to the previously added key, the compressed path of the node is
+// prev[start:end].
+type buildFrame[V any] struct {
+	start    int
+	end      int
+	hasValue bool
+	value    V
+	keys     []byte
+	children []node[V]
+}
+
+// Add adds the key and value to the tree being built. key must be greater than the previously
+// added key, otherwise ErrNotSorted is returned and the key is not added. The key is copied
+// so the caller is free to reuse it once Add returns.
+func (b *Builder[V]) Add(key []byte, value V) error {
+	if b.depth == 0 {
+		b.push(0, key, value)
+		return nil
+	}
+	prefixLen := prefixSize(b.prev, key)
+	if prefixLen == len(key) || (prefixLen < len(b.prev) && key[prefixLen] < b.prev[prefixLen]) {
+		return ErrNotSorted
+	}
+	// nodes below the point where key diverges from the previous key can't get any more
+	// children, so can be finished.
+	for b.top().start > prefixLen {
+		b.finishTop()
+	}
+	if top := b.top(); top.end > prefixLen {
+		// key diverges part way through the compressed path of top, so it needs splitting
+		// into a parent with the first part of the path, and top with the rest.
+		child := top.build(b.prev[prefixLen+1 : top.end])
+		var zero V
+		top.end = prefixLen
+		top.hasValue = false
+		top.value = zero
+		top.keys = append(top.keys[:0], b.prev[prefixLen])
+		clearChildren(top.children)
+		top.children = append(top.children[:0], child)
+	}
+	b.push(prefixLen+1, key, value)
+	return nil
+}
+
+// push adds a new frame for key, with a path that starts at key[start].
+func (b *Builder[V]) push(start int, key []byte, value V) {
+	if b.depth == len(b.stack) {
+		b.stack = append(b.stack, buildFrame[V]{})
+	}
+	f := &b.stack[b.depth]
+	f.start = start
+	f.end = len(key)
+	f.hasValue = true
+	f.value = value
+	f.keys = f.keys[:0]
+	f.children = f.children[:0]
+	b.depth++
+	b.prev = append(b.prev[:0], key...)
+	b.size++
+}
+
+func (b *Builder[V]) top() *buildFrame[V] {
+	return &b.stack[b.depth-1]
+}
+
+// finishTop builds the node for the top of the stack and adds it to its parent.
+func (b *Builder[V]) finishTop() {
+	child := b.top()
+	n := child.build(b.prev[child.start:child.end])
+	k := b.prev[child.start-1]
+	var zero V
+	child.value = zero
+	clearChildren(child.children)
+	b.depth--
+	parent := b.top()
+	parent.keys = append(parent.keys, k)
+	parent.children = append(parent.children, n)
+}
+
+func clearChildren[V any](c []node[V]) {
+	for i := range c {
+		c[i] = nil
+	}
+}
+
+// Tree returns the Tree containing all the added keys. The Builder is reset and
+// can be used to build another tree.
+func (b *Builder[V]) Tree() *Tree[V] {
+	// the nodes are created with the generation of a new Tree, which is 0.
+	t := &Tree[V]{size: b.size}
+	if b.depth > 0 {
+		for b.depth > 1 {
+			b.finishTop()
+		}
+		root := b.top()
+		t.root = root.build(b.prev[root.start:root.end])
+	}
+	*b = Builder[V]{}
+	return t
+}
+
+// FromNext builds a new Tree from the key/value pairs returned by next, until it returns false
+// for ok. The keys must be in ascending order without duplicates, otherwise ErrNotSorted is
+// returned. This is the pull style equivalent of FromSorted, for use without range over func.
+// See Builder for more details.
+//
+//	i := 0
+//	tree, err := art.FromNext(func() ([]byte, string, bool) {
+//		if i == len(sortedKeyValues) {
+//			return nil, "", false
+//		}
+//		i++
+//		return sortedKeyValues[i-1].Key, sortedKeyValues[i-1].Value, true
+//	})
+func FromNext[V any](next func() (key []byte, value V, ok bool)) (*Tree[V], error) {
+	b := Builder[V]{}
+	for {
+		k, v, ok := next()
+		if !ok {
+			return b.Tree(), nil
+		}
+		if err := b.Add(k, v); err != nil {
+			return nil, err
+		}
+	}
+}
+
+// build creates the node for the frame, using the smallest node type that can hold
+// the frame's children and value.
+func (f *buildFrame[V]) build(path []byte) node[V] {
+	if len(f.children) == 0 {
+		return newPathLeaf(0, path, f.value)
+	}
+	count := len(f.children)
+	if f.hasValue {
+		count++
+	}
+	childCount := int16(len(f.children))
+	var n node[V]
+	switch {
+	case count <= 4:
+		n4 := &node4[V]{}
+		n4.childCount = childCount
+		copy(n4.key[:], f.keys)
+		copy(n4.children[:], f.children)
+		n = n4
+	case count <= 16:
+		n16 := &node16[V]{}
+		n16.childCount = childCount
+		copy(n16.key[:], f.keys)
+		copy(n16.children[:], f.children)
+		n = n16
+	case count <= 48:
+		n48 := &node48[V]{}
+		n48.childCount = childCount
+		for i := range n48.key {
+			n48.key[i] = n48NoChildForKey
+		}
+		for slot, k := range f.keys {
+			n48.key[k] = byte(slot)
+		}
+		copy(n48.children[:], f.children)
+		n = n48
+	default:
+		n256 := &node256[V]{}
+		n256.childCount = childCount
+		for i, k := range f.keys {
+			n256.children[k] = f.children[i]
+		}
+		n = n256
+	}
+	for _, c := range f.children {
+		n.addSize(sizeOf(c))
+	}
+	if f.hasValue {
+		n.setNodeValue(newLeaf(f.value))
+	}
+	return withPath(0, n, path)
+}
@@ -0,0 +1,145 @@
+package art
+
+import (
+	"bytes"
+	"fmt"
+	"reflect"
+	"sort"
+	"testing"
+)
+
+func Test_BuilderEmpty(t *testing.T) {
+	b := Builder[int]{}
+	a := b.Tree()
+	if a.Len() != 0 || a.root != nil {
+		t.Errorf("Tree from an empty builder should be empty")
+	}
+	hasKeyVals(t, a, nil)
+}
+
+func Test_BuilderNotSorted(t *testing.T) {
+	b := Builder[int]{}
+	adds := []struct {
+		key []byte
+		err error
+	}{
+		{[]byte{1, 2, 3}, nil},
+		{[]byte{1, 2, 3}, ErrNotSorted},
+		{[]byte{1, 2}, ErrNotSorted},
+		{[]byte{1, 1, 4}, ErrNotSorted},
+		{[]byte{1, 2, 3, 0}, nil},
+		{[]byte{1, 3}, nil},
+		{nil, ErrNotSorted},
+	}
+	for _, a := range adds {
+		if err := b.Add(a.key, len(a.key)); err != a.err {
+			t.Errorf("Add(%v) returned error %v but expecting %v", a.key, err, a.err)
+		}
+	}
+	hasKeyVals(t, b.Tree(), []keyVal[int]{
+		kv([]byte{1, 2, 3}, 3),
+		kv([]byte{1, 2, 3, 0}, 4),
+		kv([]byte{1, 3}, 2),
+	})
+}
+
+func Test_BuilderMatchesPut(t *testing.T) {
+	// for keys that don't need long compressed paths, the builder should generate the same tree as Put would.
+	sizes := []int{1, 2, 3, 4, 5, 16, 17, 48, 49, 300, 5000}
+	for _, sz := range sizes {
+		t.Run(fmt.Sprintf("size %d", sz), func(t *testing.T) {
+			s := kvStore[int]{}
+			for i := 0; i < sz; i++ {
+				s.put(kv(rndKey(), i))
+			}
+			for i := 0; i < sz/3; i++ {
+				// keys with a common prefix to generate node values & compressed paths
+				s.put(kv([]byte{1, 2, 3, byte(i), byte(i / 3)}, i))
+				s.put(kv([]byte{1, 2, 3, byte(i)}, i))
+			}
+			testBuilder(t, s.ordered(), true)
+		})
+	}
+}
+
+func Test_FromNext(t *testing.T) {
+	s := kvStore[int]{}
+	for i := 0; i < 1000; i++ {
+		s.put(kv(rndKey(), i))
+	}
+	kvs := s.ordered()
+	next := func(kvs []keyVal[int]) func() ([]byte, int, bool) {
+		i := 0
+		return func() ([]byte, int, bool) {
+			if i == len(kvs) {
+				return nil, 0, false
+			}
+			i++
+			return kvs[i-1].key, kvs[i-1].val, true
+		}
+	}
+	a, err := FromNext(next(kvs))
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	hasKeyVals(t, a, kvs)
+	if a, err = FromNext(next(nil)); err != nil || a.Len() != 0 {
+		t.Errorf("FromNext with no keys returned a tree with %d keys and error %v", a.Len(), err)
+	}
+	if _, err = FromNext(next(reverse(kvs))); err != ErrNotSorted {
+		t.Errorf("FromNext should return ErrNotSorted for keys in reverse order, but got %v", err)
+	}
+}
+
+func Test_BuilderLongPaths(t *testing.T) {
+	long := bytes.Repeat([]byte{7}, 60)
+	kvs := []keyVal[int]{
+		kv(nil, 0),
+		kv(long[:10], 1),
+		kv(long[:30], 2),
+		kv(append(long[:30:30], 1), 3),
+		kv(append(long[:30:30], 8), 4),
+		kv(long[:59], 5),
+		kv(long, 6),
+		kv(append(long[:59:59], 8), 7),
+	}
+	sort.Slice(kvs, func(i, j int) bool {
+		return bytes.Compare(kvs[i].key, kvs[j].key) < 0
+	})
+	testBuilder(t, kvs, false)
+}
+
+// testBuilder builds a tree from the supplied sorted kvs and verifies its contents, and that
+// its usable for further updates. If sameStats is set it also checks that the tree has the
+// same shape as one built from calling Put.
+func testBuilder(t *testing.T, kvs []keyVal[int], sameStats bool) {
+	b := Builder[int]{}
+	for _, e := range kvs {
+		if err := b.Add(e.key, e.val); err != nil {
+			t.Fatalf("Unexpected error %v adding key %v", err, e.key)
+		}
+	}
+	a := b.Tree()
+	hasKeyVals(t, a, kvs)
+	if sameStats {
+		p := new(Tree[int])
+		for _, e := range kvs {
+			p.Put(e.key, e.val)
+		}
+		if !reflect.DeepEqual(p.Stats(), a.Stats()) {
+			t.Errorf("Tree from the builder has stats %#v, but expecting %#v", *a.Stats(), *p.Stats())
+		}
+	}
+	s := kvStore[int]{kvs: append([]keyVal[int](nil), kvs...)}
+	for i, e := range randDeleteOrder(kvs) {
+		if i%2 == 0 {
+			a.Delete(e.key)
+			s.delete(e.key)
+		} else {
+			k := append(append([]byte(nil), e.key...), 42)
+			a.Put(k, i)
+			s.put(kv(k, i))
+		}
+	}
+	hasKeyVals(t, a, s.ordered())
+}
@@ -0,0 +1,845 @@
+package art
+
+import (
+	"bytes"
+	"runtime"
+	"sync/atomic"
+	"unsafe"
+)
+
+// ConcurrentTree is an Adaptive Radix Tree that is safe for concurrent use by multiple goroutines.
+// It uses optimistic lock coupling as described in "The ART of Practical Synchronization"
+// https://db.in.tum.de/~leis/papers/artsync.pdf. Each inner node has a version, readers don't
+// take any locks, instead they check that the version of each node is unchanged after reading
+// from it, and restart from the root if it has changed. Writers lock only the nodes they modify,
+// along with the parent when the node needs replacing with a different one.
+//
+// The tree has its own node types, rather than those used by Tree. Everything in a node that
+// can change while readers are reading it is accessed atomically, and leaves are never modified
+// once they're in the tree, changing the value for a key replaces the leaf. Nodes that are
+// replaced are marked obsolete, and are garbage collected once no readers are using them.
+//
+// A ConcurrentTree must be created with NewConcurrentTree.
+type ConcurrentTree[V any] struct {
+	// size is first so that it's 64 bit aligned for atomic access on 32 bit platforms.
+	size int64
+	// root is never replaced, which means there's always a node to lock when changing
+	// the top of the tree. Its path is always empty.
+	root *cnode[V]
+}
+
+// NewConcurrentTree returns a new empty ConcurrentTree.
+func NewConcurrentTree[V any]() *ConcurrentTree[V] {
+	return &ConcurrentTree[V]{root: newCNode[V](256)}
+}
+
+// Len returns the number of keys in the tree.
+func (c *ConcurrentTree[V]) Len() int {
+	return int(atomic.LoadInt64(&c.size))
+}
+
+// Get the value for the provided key. exists is true if the key contains a value in the tree,
+// false otherwise.
+func (c *ConcurrentTree[V]) Get(key []byte) (value V, exists bool) {
+	for {
+		value, exists, ok := c.get(key)
+		if ok {
+			return value, exists
+		}
+		runtime.Gosched()
+	}
+}
+
+// get returns ok false if a concurrent change was detected, in which case it should be restarted.
+func (c *ConcurrentTree[V]) get(key []byte) (value V, exists bool, ok bool) {
+	n, ok := readLock(c.root, 0)
+	if !ok {
+		return value, false, false
+	}
+	for {
+		path := n.n.loadPath()
+		matched := bytes.HasPrefix(key, path.asSlice())
+		if !n.check() {
+			return value, false, false
+		}
+		if !matched {
+			return value, false, true
+		}
+		key = key[path.len:]
+		if len(key) == 0 {
+			l := n.n.loadValue()
+			if !n.check() {
+				return value, false, false
+			}
+			if l == nil {
+				return value, false, true
+			}
+			return l.value, true, true
+		}
+		child := n.n.child(key[0])
+		if !n.check() {
+			return value, false, false
+		}
+		if child == nil {
+			return value, false, true
+		}
+		if l := asLeaf[V](child); l != nil {
+			if !bytes.Equal(l.path.asSlice(), key[1:]) {
+				return value, false, true
+			}
+			return l.value, true, true
+		}
+		next, ok := readLock((*cnode[V])(child), key[0])
+		if !ok || !n.check() {
+			return value, false, false
+		}
+		n = next
+		key = key[1:]
+	}
+}
+
+// Put inserts or updates a value in the tree associated with the provided key.
+func (c *ConcurrentTree[V]) Put(key []byte, value V) {
+	for !c.put(key, value) {
+		runtime.Gosched()
+	}
+}
+
+// put returns false if a concurrent change was detected, in which case it should be restarted.
+func (c *ConcurrentTree[V]) put(key []byte, value V) bool {
+	var parent olcNode[V]
+	n, ok := readLock(c.root, 0)
+	if !ok {
+		return false
+	}
+	for {
+		path := n.n.loadPath().asSlice()
+		prefixLen := prefixSize(key, path)
+		if !n.check() {
+			return false
+		}
+		if prefixLen < len(path) {
+			// key diverges part way through n's path, so n is replaced in its parent with a new
+			// node4 with the shared part of the path, that has n and the new key as children.
+			if !lockBoth(&parent, &n) {
+				return false
+			}
+			split := newCNode[V](4)
+			split.storePath(path[:prefixLen])
+			split.addChild(path[prefixLen], unsafe.Pointer(n.n))
+			n.n.storePath(path[prefixLen+1:])
+			split.insert(key[prefixLen:], value)
+			parent.n.replaceChild(n.key, unsafe.Pointer(split))
+			n.unlock()
+			parent.unlock()
+			atomic.AddInt64(&c.size, 1)
+			return true
+		}
+		key = key[prefixLen:]
+		if len(key) == 0 {
+			existing := n.n.loadValue()
+			if !n.lock() {
+				return false
+			}
+			n.n.storeValue(newCLeaf(nil, value))
+			n.unlock()
+			if existing == nil {
+				atomic.AddInt64(&c.size, 1)
+			}
+			return true
+		}
+		child := n.n.child(key[0])
+		full := n.n.full()
+		if !n.check() {
+			return false
+		}
+		if child == nil {
+			if !full {
+				if !n.lock() {
+					return false
+				}
+				n.n.insert(key, value)
+				n.unlock()
+			} else {
+				if !lockBoth(&parent, &n) {
+					return false
+				}
+				g := n.n.resized(growCapacity(len(n.n.children)))
+				g.insert(key, value)
+				parent.n.replaceChild(n.key, unsafe.Pointer(g))
+				n.unlockObsolete()
+				parent.unlock()
+			}
+			atomic.AddInt64(&c.size, 1)
+			return true
+		}
+		if l := asLeaf[V](child); l != nil {
+			if !n.lock() {
+				return false
+			}
+			if bytes.Equal(l.path.asSlice(), key[1:]) {
+				n.n.replaceChild(key[0], unsafe.Pointer(newCLeaf(l.path.asSlice(), value)))
+			} else {
+				n.n.replaceChild(key[0], splitLeaf(l, key[1:], value))
+				atomic.AddInt64(&c.size, 1)
+			}
+			n.unlock()
+			return true
+		}
+		next, ok := readLock((*cnode[V])(child), key[0])
+		if !ok || !n.check() {
+			return false
+		}
+		parent, n = n, next
+		key = key[1:]
+	}
+}
+
+// splitLeaf returns a new node4 that contains both the existing leaf l, and the value for key.
+// key is relative to the start of l's path, and is different to it.
+func splitLeaf[V any](l *cleaf[V], key []byte, value V) unsafe.Pointer {
+	path := l.path.asSlice()
+	prefixLen := prefixSize(key, path)
+	n := newCNode[V](4)
+	n.storePath(path[:prefixLen])
+	n.insert(path[prefixLen:], l.value)
+	n.insert(key[prefixLen:], value)
+	return unsafe.Pointer(n)
+}
+
+// Delete removes the value associated with the supplied key if it exists.
+func (c *ConcurrentTree[V]) Delete(key []byte) {
+	for !c.delete(key) {
+		runtime.Gosched()
+	}
+}
+
+// delete returns false if a concurrent change was detected, or if a node on the path to key was
+// shrunk, in which case it should be restarted.
+func (c *ConcurrentTree[V]) delete(key []byte) bool {
+	var parent olcNode[V]
+	n, ok := readLock(c.root, 0)
+	if !ok {
+		return false
+	}
+	for {
+		if parent.n != nil && n.n.shrinkable() {
+			// a previous delete left n with too few entries, see remove.
+			if lockBoth(&parent, &n) {
+				c.replaceShrunk(&parent, &n)
+				parent.unlock()
+			}
+			return false
+		}
+		path := n.n.loadPath()
+		matched := bytes.HasPrefix(key, path.asSlice())
+		if !n.check() {
+			return false
+		}
+		if !matched {
+			return true
+		}
+		key = key[path.len:]
+		var child unsafe.Pointer
+		var l *cleaf[V]
+		if len(key) == 0 {
+			l = n.n.loadValue()
+		} else if child = n.n.child(key[0]); child != nil {
+			l = asLeaf[V](child)
+		}
+		if !n.check() {
+			return false
+		}
+		if len(key) == 0 || l != nil {
+			if l == nil || (len(key) > 0 && !bytes.Equal(l.path.asSlice(), key[1:])) {
+				return true
+			}
+			return c.remove(&parent, &n, key)
+		}
+		if child == nil {
+			return true
+		}
+		next, ok := readLock((*cnode[V])(child), key[0])
+		if !ok || !n.check() {
+			return false
+		}
+		parent, n = n, next
+		key = key[1:]
+	}
+}
+
+// remove removes the value for key from n, key is the remaining part of the key after n's path.
+// If that leaves n with few enough entries, it's replaced in the parent with a smaller node. It
+// returns false if a concurrent change was detected. It also returns false if the parent now
+// needs shrinking, as that requires its parent to be locked, so the delete is restarted to do it.
+func (c *ConcurrentTree[V]) remove(parent, n *olcNode[V], key []byte) bool {
+	if parent.n == nil {
+		if !n.lock() {
+			return false
+		}
+	} else if !lockBoth(parent, n) {
+		return false
+	}
+	if len(key) == 0 {
+		n.n.storeValue(nil)
+	} else {
+		n.n.removeChild(key[0])
+	}
+	atomic.AddInt64(&c.size, -1)
+	if parent.n == nil {
+		// n is the root, which is never replaced
+		n.unlock()
+		return true
+	}
+	c.replaceShrunk(parent, n)
+	done := parent.n == c.root || !parent.n.shrinkable()
+	parent.unlock()
+	return done
+}
+
+// replaceShrunk replaces n in its parent with the result of shrunk if that's different to n. Both
+// must be locked, n is unlocked by this, the parent is left locked.
+func (c *ConcurrentTree[V]) replaceShrunk(parent, n *olcNode[V]) {
+	switch s := n.n.shrunk(); s {
+	case unsafe.Pointer(n.n):
+		n.unlock()
+		return
+	case nil:
+		parent.n.removeChild(n.key)
+	default:
+		parent.n.replaceChild(n.key, s)
+	}
+	n.unlockObsolete()
+}
+
+// Walk will call the provided callback function with each key/value pair, in key order. Walk
+// doesn't block writers, and the callback is free to change the tree. Keys that are changed while
+// the walk is running may or may not be seen by it. The key is only valid for the duration of the
+// callback, and must not be modified.
+func (c *ConcurrentTree[V]) Walk(callback func(key []byte, value V) WalkState) {
+	w := concurrentWalk[V]{callback: callback}
+	prefix := make([]byte, 0, 32)
+	for {
+		if n, ok := readLock(c.root, 0); ok {
+			if _, ok := w.walk(&n, prefix); ok {
+				return
+			}
+		}
+		runtime.Gosched()
+	}
+}
+
+// concurrentWalk is the state of a Walk. If a concurrent change is detected the walk is restarted
+// from the root, skipping the keys up to and including the last one passed to the callback.
+type concurrentWalk[V any] struct {
+	callback func(key []byte, value V) WalkState
+	// the last key passed to the callback, started is false until there is one.
+	last    []byte
+	started bool
+}
+
+// walk walks the node n, which has been read locked. prefix is the key up to the start of n's
+// path. ok is false if a concurrent change was detected.
+func (w *concurrentWalk[V]) walk(n *olcNode[V], prefix []byte) (state WalkState, ok bool) {
+	path := n.n.loadPath()
+	value := n.n.loadValue()
+	children := n.n.sortedChildren()
+	if !n.check() {
+		return Stop, false
+	}
+	prefix = append(prefix, path.asSlice()...)
+	if value != nil && w.visit(prefix, value.value) == Stop {
+		return Stop, true
+	}
+	for _, c := range children {
+		key := append(prefix, c.key)
+		if w.started && bytes.Compare(key, w.last) < 0 && !bytes.HasPrefix(w.last, key) {
+			// everything under this child has already been visited.
+			continue
+		}
+		// the callback may have changed n, in which case the child may no longer be in the tree,
+		// or may have a different key.
+		if !n.check() {
+			return Stop, false
+		}
+		if l := asLeaf[V](c.n); l != nil {
+			if w.visit(append(key, l.path.asSlice()...), l.value) == Stop {
+				return Stop, true
+			}
+			continue
+		}
+		next, ok := readLock((*cnode[V])(c.n), c.key)
+		if !ok || !n.check() {
+			return Stop, false
+		}
+		if state, ok := w.walk(&next, key); state == Stop {
+			return state, ok
+		}
+	}
+	return Continue, true
+}
+
+// visit calls the callback for key, unless it's already been visited.
+func (w *concurrentWalk[V]) visit(key []byte, value V) WalkState {
+	if w.started && bytes.Compare(key, w.last) <= 0 {
+		return Continue
+	}
+	w.started = true
+	w.last = append(w.last[:0], key...)
+	return w.callback(key, value)
+}
+
+// cnode is an inner node of a ConcurrentTree. Like Tree there are node types for 4, 16, 48 and
+// 256 children, here the type is determined by the number of children there's space for. Unlike
+// Tree, the value is always kept separately from the children.
+type cnode[V any] struct {
+	// the optimistic lock. It's the first field so that it's 64 bit aligned for atomic access on
+	// 32 bit platforms, and so that it's in the same place as the version of a leaf.
+	version uint64
+	// the compressed path, a *keyPath. It's replaced rather than modified.
+	path unsafe.Pointer
+	// the value for the key that ends at this node, a *cleaf[V] or nil.
+	value unsafe.Pointer
+	// the number of populated children.
+	count int32
+	// the keys for the children, packed 4 to a word. For nodes with up to 16 children key i
+	// is for child i. For 48 children the key byte is the index, and the key is the child's
+	// index + 1, or 0 for no child. Nodes with 256 children don't need keys.
+	keys []uint32
+	// each child is either a *cnode[V] or a *cleaf[V].
+	children []unsafe.Pointer
+}
+
+// cleaf is a leaf of a ConcurrentTree. It's never changed once it's in the tree.
+type cleaf[V any] struct {
+	// always olcLeaf, this is how a leaf is told apart from a cnode.
+	version uint64
+	path    keyPath
+	value   V
+}
+
+func newCNode[V any](capacity int) *cnode[V] {
+	return &cnode[V]{
+		path:     unsafe.Pointer(&keyPath{}),
+		keys:     newKeys(capacity),
+		children: make([]unsafe.Pointer, capacity),
+	}
+}
+
+func newCLeaf[V any](path []byte, value V) *cleaf[V] {
+	l := &cleaf[V]{version: olcLeaf, value: value}
+	l.path.assign(path)
+	return l
+}
+
+// newCPathLeaf returns a leaf for value with the path key. If the path is too long to fit in the
+// leaf then node4s are added above it to hold the rest of the path, in the same way as withPath.
+func newCPathLeaf[V any](key []byte, value V) unsafe.Pointer {
+	maxLen := len(keyPath{}.key)
+	kst := max(0, len(key)-maxLen)
+	curr := unsafe.Pointer(newCLeaf(key[kst:], value))
+	key = key[:kst]
+	for len(key) > 0 {
+		n := newCNode[V](4)
+		kend := len(key) - 1
+		n.addChild(key[kend], curr)
+		kst := max(0, kend-maxLen)
+		n.storePath(key[kst:kend])
+		key = key[:kst]
+		curr = unsafe.Pointer(n)
+	}
+	return curr
+}
+
+// asLeaf returns the child c as a leaf, or nil if it's a cnode.
+func asLeaf[V any](c unsafe.Pointer) *cleaf[V] {
+	if atomic.LoadUint64((*uint64)(c)) == olcLeaf {
+		return (*cleaf[V])(c)
+	}
+	return nil
+}
+
+// growCapacity returns the capacity of the next larger node type.
+func growCapacity(capacity int) int {
+	switch capacity {
+	case 4:
+		return 16
+	case 16:
+		return 48
+	}
+	return 256
+}
+
+// shrunkCapacity returns the capacity of the smaller node type that a node with space for capacity
+// children should be replaced with when it has live children, or 0 if it shouldn't be.
+func shrunkCapacity(capacity, live int) int {
+	switch {
+	case capacity == 16 && live <= 3:
+		return 4
+	case capacity == 48 && live < 16*3/4:
+		return 16
+	case capacity == 256 && live < 48*3/4:
+		return 48
+	}
+	return 0
+}
+
+func (n *cnode[V]) loadPath() *keyPath {
+	return (*keyPath)(atomic.LoadPointer(&n.path))
+}
+
+func (n *cnode[V]) storePath(path []byte) {
+	p := &keyPath{}
+	p.assign(path)
+	atomic.StorePointer(&n.path, unsafe.Pointer(p))
+}
+
+func (n *cnode[V]) loadValue() *cleaf[V] {
+	return (*cleaf[V])(atomic.LoadPointer(&n.value))
+}
+
+func (n *cnode[V]) storeValue(l *cleaf[V]) {
+	atomic.StorePointer(&n.value, unsafe.Pointer(l))
+}
+
+func (n *cnode[V]) key(i int) byte {
+	return loadKey(n.keys, i)
+}
+
+func (n *cnode[V]) setKey(i int, k byte) {
+	storeKey(n.keys, i, k)
+}
+
+// newKeys returns the keys for a node with space for capacity children, see loadKey. Nodes with
+// up to 16 children have a key for each child, nodes with 48 children have an entry for every
+// key byte, and nodes with 256 children don't need keys.
+func newKeys(capacity int) []uint32 {
+	switch capacity {
+	case 4, 16:
+		return make([]uint32, capacity/4)
+	case 48:
+		return make([]uint32, 256/4)
+	}
+	return nil
+}
+
+// loadKey returns key i from keys, which has 4 keys packed into each word so that they can be
+// accessed atomically.
+func loadKey(keys []uint32, i int) byte {
+	return byte(atomic.LoadUint32(&keys[i/4]) >> (i % 4 * 8))
+}
+
+// storeKey sets key i in keys to k, see loadKey.
+func storeKey(keys []uint32, i int, k byte) {
+	w := &keys[i/4]
+	shift := i % 4 * 8
+	atomic.StoreUint32(w, atomic.LoadUint32(w)&^(0xFF<<shift)|uint32(k)<<shift)
+}
+
+// slot returns the index into children for the key k, or -1 if there isn't one. n may be being
+// modified concurrently, so the result must not be used until the node's version has been checked.
+func (n *cnode[V]) slot(k byte) int {
+	switch len(n.children) {
+	case 256:
+		return int(k)
+	case 48:
+		return int(n.key(int(k))) - 1
+	}
+	count := int(atomic.LoadInt32(&n.count))
+	for i := 0; i < count && i < len(n.children); i++ {
+		if n.key(i) == k {
+			return i
+		}
+	}
+	return -1
+}
+
+// child returns the child for key k, or nil if there isn't one.
+func (n *cnode[V]) child(k byte) unsafe.Pointer {
+	if i := n.slot(k); i >= 0 && i < len(n.children) {
+		return atomic.LoadPointer(&n.children[i])
+	}
+	return nil
+}
+
+// full returns true if there's no space for another child.
+func (n *cnode[V]) full() bool {
+	return int(atomic.LoadInt32(&n.count)) >= len(n.children)
+}
+
+// onlyChild returns the key and child of a node that has a single child. n may be being modified
+// concurrently, so the result must not be used until the node's version has been checked.
+func (n *cnode[V]) onlyChild() (k byte, c unsafe.Pointer) {
+	switch len(n.children) {
+	case 256:
+		for k := range n.children {
+			if c := atomic.LoadPointer(&n.children[k]); c != nil {
+				return byte(k), c
+			}
+		}
+	case 48:
+		for k := 0; k < 256; k++ {
+			if i := n.key(k); i > 0 {
+				return byte(k), atomic.LoadPointer(&n.children[i-1])
+			}
+		}
+	default:
+		return n.key(0), atomic.LoadPointer(&n.children[0])
+	}
+	return 0, nil
+}
+
+// cchild is a child of a cnode, along with its key.
+type cchild struct {
+	key byte
+	n   unsafe.Pointer
+}
+
+// sortedChildren returns n's children in key order. n may be being modified concurrently, so the
+// result must not be used until the node's version has been checked.
+func (n *cnode[V]) sortedChildren() []cchild {
+	var children []cchild
+	switch len(n.children) {
+	case 256:
+		for k := range n.children {
+			if c := atomic.LoadPointer(&n.children[k]); c != nil {
+				children = append(children, cchild{byte(k), c})
+			}
+		}
+	case 48:
+		for k := 0; k < 256; k++ {
+			if i := n.key(k); i > 0 {
+				children = append(children, cchild{byte(k), atomic.LoadPointer(&n.children[i-1])})
+			}
+		}
+	default:
+		count := int(atomic.LoadInt32(&n.count))
+		for i := 0; i < count && i < len(n.children); i++ {
+			children = append(children, cchild{n.key(i), atomic.LoadPointer(&n.children[i])})
+		}
+		for i := 1; i < len(children); i++ {
+			for j := i; j > 0 && children[j-1].key > children[j].key; j-- {
+				children[j-1], children[j] = children[j], children[j-1]
+			}
+		}
+	}
+	return children
+}
+
+// shrinkable returns true if n should be replaced with the result of shrunk. n may be being
+// modified concurrently, so the result must not be used until the node's version has been checked.
+func (n *cnode[V]) shrinkable() bool {
+	count := int(atomic.LoadInt32(&n.count))
+	switch {
+	case count == 0:
+		return true
+	case count == 1 && n.loadValue() == nil:
+		_, child := n.onlyChild()
+		if child == nil {
+			return false
+		}
+		pathLen := n.loadPath().len
+		if l := asLeaf[V](child); l != nil {
+			if l.path.canExtendBy(pathLen + 1) {
+				return true
+			}
+		} else if (*cnode[V])(child).loadPath().canExtendBy(pathLen + 1) {
+			return true
+		}
+	}
+	return shrunkCapacity(len(n.children), count) != 0
+}
+
+// The remaining methods change the node, so it must either be locked, or not yet be in the tree.
+
+// insert adds a value for key to n. n must not have an existing value or child for key, and
+// must have space for it.
+func (n *cnode[V]) insert(key []byte, value V) {
+	if len(key) == 0 {
+		n.storeValue(newCLeaf(nil, value))
+		return
+	}
+	n.addChild(key[0], newCPathLeaf(key[1:], value))
+}
+
+func (n *cnode[V]) addChild(k byte, c unsafe.Pointer) {
+	count := int(n.count)
+	switch len(n.children) {
+	case 256:
+		atomic.StorePointer(&n.children[k], c)
+	case 48:
+		i := 0
+		for n.children[i] != nil {
+			i++
+		}
+		atomic.StorePointer(&n.children[i], c)
+		n.setKey(int(k), byte(i+1))
+	default:
+		atomic.StorePointer(&n.children[count], c)
+		n.setKey(count, k)
+	}
+	atomic.StoreInt32(&n.count, int32(count+1))
+}
+
+func (n *cnode[V]) replaceChild(k byte, c unsafe.Pointer) {
+	atomic.StorePointer(&n.children[n.slot(k)], c)
+}
+
+func (n *cnode[V]) removeChild(k byte) {
+	i := n.slot(k)
+	last := int(n.count) - 1
+	switch len(n.children) {
+	case 256:
+		atomic.StorePointer(&n.children[i], nil)
+	case 48:
+		atomic.StorePointer(&n.children[i], nil)
+		n.setKey(int(k), 0)
+	default:
+		// move the last child into the gap.
+		atomic.StorePointer(&n.children[i], n.children[last])
+		n.setKey(i, n.key(last))
+		atomic.StorePointer(&n.children[last], nil)
+	}
+	atomic.StoreInt32(&n.count, int32(last))
+}
+
+// eachChild calls cb with the key and child for each of n's children.
+func (n *cnode[V]) eachChild(cb func(k byte, c unsafe.Pointer)) {
+	switch len(n.children) {
+	case 256:
+		for k, c := range n.children {
+			if c != nil {
+				cb(byte(k), c)
+			}
+		}
+	case 48:
+		for k := 0; k < 256; k++ {
+			if i := n.key(k); i > 0 {
+				cb(byte(k), n.children[i-1])
+			}
+		}
+	default:
+		for i := 0; i < int(n.count); i++ {
+			cb(n.key(i), n.children[i])
+		}
+	}
+}
+
+// resized returns a new node with space for capacity children, that has the same path, value
+// and children as n.
+func (n *cnode[V]) resized(capacity int) *cnode[V] {
+	r := newCNode[V](capacity)
+	r.path = n.path
+	r.value = n.value
+	n.eachChild(r.addChild)
+	return r
+}
+
+// shrunk returns the node that should replace n after something has been removed from it. This is
+// nil if n is empty, a leaf if n has only a value or a single leaf child, n's child if n has a
+// single inner node child, a smaller node if n has few enough children, otherwise it's n.
+func (n *cnode[V]) shrunk() unsafe.Pointer {
+	count := int(n.count)
+	value := n.loadValue()
+	path := n.loadPath()
+	switch {
+	case count == 0 && value == nil:
+		return nil
+	case count == 0:
+		return unsafe.Pointer(newCLeaf(path.asSlice(), value.value))
+	case count == 1 && value == nil:
+		k, child := n.onlyChild()
+		if l := asLeaf[V](child); l != nil {
+			if l.path.canExtendBy(path.len + 1) {
+				c := &cleaf[V]{version: olcLeaf, path: l.path, value: l.value}
+				c.path.prependPath(path.asSlice(), k)
+				return unsafe.Pointer(c)
+			}
+		} else if cn := (*cnode[V])(child); cn.loadPath().canExtendBy(path.len + 1) {
+			// n's path is moved to the start of the child's, which needs the child to be locked.
+			// It can't be replaced while n is locked, so this only waits for other writers that
+			// are changing its children.
+			o := lockWait(cn)
+			p := *cn.loadPath()
+			p.prependPath(path.asSlice(), k)
+			atomic.StorePointer(&cn.path, unsafe.Pointer(&p))
+			o.unlock()
+			return child
+		}
+	}
+	if capacity := shrunkCapacity(len(n.children), count); capacity != 0 {
+		return unsafe.Pointer(n.resized(capacity))
+	}
+	return unsafe.Pointer(n)
+}
+
+const (
+	olcObsolete = 1
+	olcLocked   = 2
+	// olcLeaf is the version of every leaf. Leaves are never locked, and the version of an inner
+	// node will never get anywhere near this.
+	olcLeaf = 1 << 63
+)
+
+// olcNode is an inner node on the path through the tree, along with the version of the node that
+// was read, and the key for the node in its parent.
+type olcNode[V any] struct {
+	n       *cnode[V]
+	version uint64
+	key     byte
+}
+
+// readLock returns the node along with its current version. ok is false if the node is locked
+// or obsolete.
+func readLock[V any](n *cnode[V], key byte) (o olcNode[V], ok bool) {
+	v := atomic.LoadUint64(&n.version)
+	if v&(olcLocked|olcObsolete) != 0 {
+		return o, false
+	}
+	return olcNode[V]{n: n, version: v, key: key}, true
+}
+
+// check returns true if the node hasn't changed since it was read.
+func (o *olcNode[V]) check() bool {
+	return atomic.LoadUint64(&o.n.version) == o.version
+}
+
+// lock upgrades the read of the node to a write lock. It returns false if the node has changed
+// since it was read.
+func (o *olcNode[V]) lock() bool {
+	return atomic.CompareAndSwapUint64(&o.n.version, o.version, o.version+olcLocked)
+}
+
+func (o *olcNode[V]) unlock() {
+	atomic.AddUint64(&o.n.version, olcLocked)
+}
+
+// unlockObsolete unlocks the node and marks it obsolete, this should be done once it's been
+// removed from the tree.
+func (o *olcNode[V]) unlockObsolete() {
+	atomic.AddUint64(&o.n.version, olcLocked+olcObsolete)
+}
+
+// lockBoth locks the parent and then the node. It returns false if either has changed since they
+// were read, in which case neither is locked.
+func lockBoth[V any](parent, n *olcNode[V]) bool {
+	if !parent.lock() {
+		return false
+	}
+	if !n.lock() {
+		parent.unlock()
+		return false
+	}
+	return true
+}
+
+// lockWait locks n, waiting for any other writer to unlock it first. It must only be used when n
+// can't be made obsolete while waiting, i.e. its parent is locked.
+func lockWait[V any](n *cnode[V]) olcNode[V] {
+	for {
+		if o, ok := readLock(n, 0); ok && o.lock() {
+			return o
+		}
+		runtime.Gosched()
+	}
+}
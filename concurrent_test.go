@@ -0,0 +1,256 @@
+package art
+
+import (
+	"bytes"
+	"encoding/binary"
+	"math/rand"
+	"sync"
+	"testing"
+)
+
+func Test_ConcurrentTree(t *testing.T) {
+	c := NewConcurrentTree[int]()
+	s := &kvStore[int]{}
+	keys := make([][]byte, 0, 2000)
+	for _, k := range [][]byte{nil, {1}, bytes.Repeat([]byte{2}, 60), append(bytes.Repeat([]byte{2}, 60), 1)} {
+		keys = append(keys, k)
+	}
+	for i := 0; i < 2000; i++ {
+		keys = append(keys, rndKey())
+	}
+	for i, k := range keys {
+		c.Put(k, i)
+		s.put(kv(k, i))
+	}
+	checkConcurrentTree(t, c, s)
+	// overwrite some and delete others.
+	for i, k := range keys {
+		switch i % 3 {
+		case 0:
+			c.Delete(k)
+			s.delete(k)
+		case 1:
+			c.Put(k, -i)
+			s.put(kv(k, -i))
+		}
+	}
+	c.Delete([]byte{3, 3, 3})
+	checkConcurrentTree(t, c, s)
+	for _, k := range keys {
+		c.Delete(k)
+		s.delete(k)
+	}
+	checkConcurrentTree(t, c, s)
+}
+
+func checkConcurrentTree[V comparable](t *testing.T, c *ConcurrentTree[V], s *kvStore[V]) {
+	t.Helper()
+	for _, e := range s.kvs {
+		if v, exists := c.Get(e.key); !exists || v != e.val {
+			t.Errorf("Get(%v) returned %v %t, expecting %v true", e.key, v, exists, e.val)
+		}
+	}
+	if c.Len() != len(s.kvs) {
+		t.Errorf("Len() returned %d, expecting %d", c.Len(), len(s.kvs))
+	}
+	exp := s.ordered()
+	i := 0
+	c.Walk(func(k []byte, v V) WalkState {
+		if i >= len(exp) || !bytes.Equal(k, exp[i].key) || v != exp[i].val {
+			t.Errorf("Walk returned unexpected key/value %v / %v at %d", k, v, i)
+		}
+		i++
+		return Continue
+	})
+	if i != len(exp) {
+		t.Errorf("Walk returned %d keys, expecting %d", i, len(exp))
+	}
+	checkCNodes(t, c.root)
+}
+
+// checkCNodes verifies that none of the nodes below n should have been shrunk.
+func checkCNodes[V any](t *testing.T, n *cnode[V]) {
+	t.Helper()
+	for _, c := range n.sortedChildren() {
+		if asLeaf[V](c.n) != nil {
+			continue
+		}
+		child := (*cnode[V])(c.n)
+		if child.shrinkable() {
+			t.Errorf("Node with %d children should have been shrunk", child.count)
+		}
+		checkCNodes(t, child)
+	}
+}
+
+func Test_ConcurrentTreeDeleteShrinksPath(t *testing.T) {
+	key := func(suffix ...byte) []byte {
+		return append(bytes.Repeat([]byte{5}, 10), suffix...)
+	}
+	c := NewConcurrentTree[int]()
+	c.Put(key(1), 1)
+	c.Put(key(2), 2)
+	c.Delete(key(2))
+	checkConcurrentTree(t, c, &kvStore[int]{kvs: []keyVal[int]{kv(key(1), 1)}})
+	if asLeaf[int](c.root.child(5)) == nil {
+		t.Errorf("The node should have been replaced by the remaining leaf")
+	}
+	// a node with a single inner node child is merged into the child.
+	c = NewConcurrentTree[int]()
+	c.Put(key(1, 1), 1)
+	c.Put(key(1, 2), 2)
+	c.Put(key(2), 3)
+	c.Delete(key(2))
+	checkConcurrentTree(t, c, &kvStore[int]{kvs: []keyVal[int]{kv(key(1, 1), 1), kv(key(1, 2), 2)}})
+	if p := (*cnode[int])(c.root.child(5)).loadPath().asSlice(); !bytes.Equal(p, key(1)[1:]) {
+		t.Errorf("The remaining node should have the path %v, but has %v", key(1)[1:], p)
+	}
+	// the keys have more in common than fits in a path, so there's a chain of nodes for it, which
+	// checkConcurrentTree verifies is as short as it can be.
+	c = NewConcurrentTree[int]()
+	a, b := append(bytes.Repeat([]byte{5}, 60), 1), append(bytes.Repeat([]byte{5}, 60), 2)
+	c.Put(a, 1)
+	c.Put(b, 2)
+	c.Delete(b)
+	checkConcurrentTree(t, c, &kvStore[int]{kvs: []keyVal[int]{kv(a, 1)}})
+}
+
+func Test_ConcurrentTreeWalkStop(t *testing.T) {
+	c := NewConcurrentTree[int]()
+	for i := 0; i < 100; i++ {
+		c.Put([]byte{byte(i), 1}, i)
+	}
+	count := 0
+	c.Walk(func(k []byte, v int) WalkState {
+		count++
+		// changing the tree from the callback restarts the walk, without revisiting keys.
+		c.Delete([]byte{byte(v + 1), 1})
+		if count == 10 {
+			return Stop
+		}
+		return Continue
+	})
+	if count != 10 {
+		t.Errorf("Walk should of stopped after 10 keys, but visited %d", count)
+	}
+	if c.Len() != 90 {
+		t.Errorf("Len() returned %d, expecting 90", c.Len())
+	}
+}
+
+func Test_ConcurrentTreeParallel(t *testing.T) {
+	const writers = 8
+	const keysPerWriter = 5000
+	c := NewConcurrentTree[int]()
+	key := func(w, i int) []byte {
+		// vary the key length so that the writers' keys share prefixes, and are
+		// values on nodes as well as leaves.
+		k := make([]byte, 4+w)
+		binary.BigEndian.PutUint32(k, uint32(i))
+		for j := 4; j < len(k); j++ {
+			k[j] = byte(w)
+		}
+		return k
+	}
+	wg := sync.WaitGroup{}
+	stop := make(chan struct{})
+	readers := sync.WaitGroup{}
+	for r := 0; r < 4; r++ {
+		readers.Add(1)
+		go func(r int) {
+			defer readers.Done()
+			for i := 0; ; i++ {
+				select {
+				case <-stop:
+					return
+				default:
+				}
+				w := i % writers
+				k := key(w, i%keysPerWriter)
+				if v, exists := c.Get(k); exists && v != w*keysPerWriter+i%keysPerWriter {
+					t.Errorf("Get(%v) returned unexpected value %d", k, v)
+					return
+				}
+			}
+		}(r)
+	}
+	for w := 0; w < writers; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			for i := 0; i < keysPerWriter; i++ {
+				c.Put(key(w, i), w*keysPerWriter+i)
+			}
+			// delete every other key.
+			for i := 0; i < keysPerWriter; i += 2 {
+				c.Delete(key(w, i))
+			}
+		}(w)
+	}
+	wg.Wait()
+	close(stop)
+	readers.Wait()
+
+	s := &kvStore[int]{}
+	for w := 0; w < writers; w++ {
+		for i := 1; i < keysPerWriter; i += 2 {
+			s.kvs = append(s.kvs, kv(key(w, i), w*keysPerWriter+i))
+		}
+	}
+	checkConcurrentTree(t, c, s)
+}
+
+func Test_ConcurrentTreeConcurrentWriters(t *testing.T) {
+	c := NewConcurrentTree[int]()
+	const writers = 4
+	stores := make([]kvStore[int], writers)
+	wg := sync.WaitGroup{}
+	for w := 0; w < writers; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			rnd := rand.New(rand.NewSource(int64(w)))
+			s := &stores[w]
+			// the keys are from a small alphabet so that the writers share nodes, the last byte
+			// is the writer, so that each writer has its own keys.
+			key := func() []byte {
+				k := make([]byte, rnd.Intn(30))
+				for i := range k {
+					k[i] = byte(rnd.Intn(3))
+				}
+				return append(k, byte(w))
+			}
+			for i := 0; i < 3000; i++ {
+				k := key()
+				if rnd.Intn(3) == 0 {
+					c.Delete(k)
+					s.delete(k)
+				} else {
+					c.Put(k, i)
+					s.put(kv(k, i))
+				}
+			}
+		}(w)
+	}
+	wg.Wait()
+	all := &kvStore[int]{}
+	for _, s := range stores {
+		all.kvs = append(all.kvs, s.kvs...)
+	}
+	checkConcurrentTree(t, c, all)
+	// delete everything concurrently
+	for w := 0; w < writers; w++ {
+		wg.Add(1)
+		go func(s *kvStore[int]) {
+			defer wg.Done()
+			for _, e := range s.kvs {
+				c.Delete(e.key)
+			}
+		}(&stores[w])
+	}
+	wg.Wait()
+	checkConcurrentTree(t, c, &kvStore[int]{})
+	if c.root.count != 0 || c.root.value != nil {
+		t.Errorf("The root should be empty once all the keys are deleted")
+	}
+}
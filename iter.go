@@ -0,0 +1,62 @@
+//go:build go1.23
+
+package art
+
+import "iter"
+
+// All returns an iterator over all the key/value pairs in the tree, in key order.
+// As with Walk, the key is only valid until the next iteration, and should not be modified.
+//
+//	for k, v := range tree.All() {
+//		fmt.Printf("%v : %v\n", k, v)
+//	}
+func (a *Tree[V]) All() iter.Seq2[[]byte, V] {
+	return func(yield func([]byte, V) bool) {
+		a.Walk(yieldFn(yield))
+	}
+}
+
+// Range returns an iterator over the key/value pairs with keys equal to or greater than start
+// and less than end, in key order. nil can be used to mean no limit in that direction, see
+// WalkRange for more details.
+func (a *Tree[V]) Range(start, end []byte) iter.Seq2[[]byte, V] {
+	return func(yield func([]byte, V) bool) {
+		a.WalkRange(start, end, yieldFn(yield))
+	}
+}
+
+// Prefix returns an iterator over the key/value pairs whose keys start with prefix, in key order.
+func (a *Tree[V]) Prefix(prefix []byte) iter.Seq2[[]byte, V] {
+	return func(yield func([]byte, V) bool) {
+		a.WalkPrefix(prefix, yieldFn(yield))
+	}
+}
+
+// Backward returns an iterator over all the key/value pairs in the tree, in reverse key order.
+func (a *Tree[V]) Backward() iter.Seq2[[]byte, V] {
+	return func(yield func([]byte, V) bool) {
+		a.WalkReverse(yieldFn(yield))
+	}
+}
+
+// yieldFn adapts an iterator yield function to a Walk callback.
+func yieldFn[V any](yield func([]byte, V) bool) func(key []byte, value V) WalkState {
+	return func(key []byte, value V) WalkState {
+		if yield(key, value) {
+			return Continue
+		}
+		return Stop
+	}
+}
+
+// FromSorted builds a new Tree from the key/value pairs in seq, which must be in ascending key
+// order without duplicates, otherwise ErrNotSorted is returned. See Builder for more details.
+func FromSorted[V any](seq iter.Seq2[[]byte, V]) (*Tree[V], error) {
+	b := Builder[V]{}
+	for k, v := range seq {
+		if err := b.Add(k, v); err != nil {
+			return nil, err
+		}
+	}
+	return b.Tree(), nil
+}
@@ -0,0 +1,106 @@
+//go:build go1.23
+
+package art
+
+import (
+	"bytes"
+	"iter"
+	"testing"
+)
+
+func iterTestTree() (*Tree[int], *kvStore[int]) {
+	a := new(Tree[int])
+	s := &kvStore[int]{}
+	for i := 0; i < 512; i += 3 {
+		e := kv([]byte{byte(i / 256), 0xFF, byte(i)}, i)
+		a.Put(e.key, e.val)
+		s.put(e)
+	}
+	for _, k := range [][]byte{{}, {1}, {1, 0xFF}, {1, 0xFF, 0xFF, 0xFF}, {2}} {
+		e := kv(k, len(k)*1000)
+		a.Put(e.key, e.val)
+		s.put(e)
+	}
+	return a, s
+}
+
+// hasSeq verifies that seq returns the exp key/values, in order.
+func hasSeq(t *testing.T, name string, seq iter.Seq2[[]byte, int], exp []keyVal[int]) {
+	t.Helper()
+	i := 0
+	for k, v := range seq {
+		if i >= len(exp) {
+			t.Errorf("%s returned unexpected additional key/value %v / %d", name, k, v)
+		} else if !bytes.Equal(k, exp[i].key) || v != exp[i].val {
+			t.Errorf("%s returned %v / %d but expecting %v / %d", name, k, v, exp[i].key, exp[i].val)
+		}
+		i++
+	}
+	if i != len(exp) {
+		t.Errorf("%s returned %d keys, expecting %d", name, i, len(exp))
+	}
+}
+
+func Test_IterAll(t *testing.T) {
+	a, s := iterTestTree()
+	hasSeq(t, "All()", a.All(), s.ordered())
+}
+
+func Test_IterBackward(t *testing.T) {
+	a, s := iterTestTree()
+	hasSeq(t, "Backward()", a.Backward(), reverse(s.ordered()))
+	i := 0
+	for range a.Backward() {
+		i++
+		if i == 10 {
+			break
+		}
+	}
+	if i != 10 {
+		t.Errorf("Backward() returned %d keys, expecting 10", i)
+	}
+}
+
+func Test_IterRange(t *testing.T) {
+	a, s := iterTestTree()
+	cases := []keyRange{
+		{nil, nil},
+		{[]byte{0, 0xFF, 10}, []byte{1, 0xFF, 20}},
+		{[]byte{1}, nil},
+		{nil, []byte{0, 0xFF, 100}},
+	}
+	for _, tc := range cases {
+		t.Run(tc.String(), func(t *testing.T) {
+			hasSeq(t, "Range()", a.Range(tc.start, tc.end), s.orderedRange(tc.start, tc.end))
+		})
+	}
+}
+
+func Test_IterPrefix(t *testing.T) {
+	a, s := iterTestTree()
+	prefixes := [][]byte{nil, {0}, {0, 0xFF}, {1, 0xFF}, {1, 0xFF, 0xFF}, {1, 0xFF, 0xFF, 0xFF}, {2}, {3}}
+	for _, p := range prefixes {
+		t.Run(hexPath(p), func(t *testing.T) {
+			exp := []keyVal[int]{}
+			for _, e := range s.ordered() {
+				if bytes.HasPrefix(e.key, p) {
+					exp = append(exp, e)
+				}
+			}
+			hasSeq(t, "Prefix()", a.Prefix(p), exp)
+		})
+	}
+}
+
+func Test_FromSorted(t *testing.T) {
+	a, s := iterTestTree()
+	b, err := FromSorted(a.All())
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	hasKeyVals(t, b, s.ordered())
+	_, err = FromSorted(a.Backward())
+	if err != ErrNotSorted {
+		t.Errorf("FromSorted should return ErrNotSorted for keys in reverse order, but got %v", err)
+	}
+}
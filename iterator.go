@@ -0,0 +1,181 @@
+package art
+
+// Iterator is a pull style cursor over the key/value pairs in a Tree, in key order. Unlike Walk
+// the caller controls when the iterator advances, so it can be paused, handed to another
+// goroutine, or used to step through multiple trees in lockstep. The tree should not be
+// modified while an Iterator is in use.
+//
+//	for it := tree.Iterator(); it.Valid(); it.Next() {
+//		fmt.Printf("%v : %v\n", it.Key(), it.Value())
+//	}
+type Iterator[V any] struct {
+	root  node[V]
+	stack []iterFrame[V]
+	key   []byte
+	value V
+	valid bool
+}
+
+// iterFrame tracks the progress of the iterator through a single node.
+type iterFrame[V any] struct {
+	n node[V]
+	// length of the key up to and including the compressed path of n.
+	keyLen int
+	// the smallest child key that is yet to be visited, or -1 if the node's
+	// value is yet to be visited.
+	next int
+}
+
+// Iterator returns a new Iterator positioned at the first key in the tree. If the tree
+// is empty the returned Iterator is not Valid.
+func (a *Tree[V]) Iterator() *Iterator[V] {
+	return a.SeekIterator(nil)
+}
+
+// SeekIterator returns a new Iterator positioned at the first key that is equal to or
+// greater than key. If there is no such key the returned Iterator is not Valid.
+func (a *Tree[V]) SeekIterator(key []byte) *Iterator[V] {
+	it := &Iterator[V]{root: a.root, key: make([]byte, 0, 32)}
+	it.Seek(key)
+	return it
+}
+
+// Seek repositions the iterator at the first key that is equal to or greater than key.
+// It returns true if the iterator is positioned on a key, or false if there is no such
+// key. The cost of the Seek is proportional to the length of key, not the number of
+// keys that are skipped.
+func (it *Iterator[V]) Seek(key []byte) bool {
+	for i := range it.stack {
+		it.stack[i] = iterFrame[V]{}
+	}
+	it.stack = it.stack[:0]
+	it.key = it.key[:0]
+	n := it.root
+	for n != nil {
+		h := n.header()
+		path := h.path.asSlice()
+		it.push(n)
+		f := &it.stack[len(it.stack)-1]
+		prefixLen := prefixSize(key, path)
+		if prefixLen < len(path) {
+			if prefixLen < len(key) && key[prefixLen] > path[prefixLen] {
+				// everything in this node is before key
+				f.next = 256
+			}
+			// otherwise everything in this node is after key
+			break
+		}
+		key = key[len(path):]
+		if len(key) == 0 {
+			break
+		}
+		// the node's value is before key, as are any children before key[0]
+		f.next = int(key[0])
+		child := n.getChildNode(key)
+		if child == nil {
+			break
+		}
+		f.next++
+		it.key = append(it.key, key[0])
+		n = *child
+		key = key[1:]
+	}
+	return it.Next()
+}
+
+// push adds the node to the top of the stack, the node should be a child of the
+// node currently at the top of the stack, and the key should already contain
+// the child's key.
+func (it *Iterator[V]) push(n node[V]) {
+	h := n.header()
+	it.key = append(it.key, h.path.asSlice()...)
+	next := 0
+	if h.hasValue {
+		next = -1
+	}
+	it.stack = append(it.stack, iterFrame[V]{n: n, keyLen: len(it.key), next: next})
+}
+
+// Next moves the iterator on to the next key. It returns true if the iterator is
+// positioned on a key, or false if there are no more keys.
+func (it *Iterator[V]) Next() bool {
+	for len(it.stack) > 0 {
+		f := &it.stack[len(it.stack)-1]
+		it.key = it.key[:f.keyLen]
+		if f.next < 0 {
+			f.next = 0
+			it.value = f.n.valueNode().value
+			it.valid = true
+			return true
+		}
+		k, child := nextChild(f.n, f.next)
+		if child == nil {
+			it.stack[len(it.stack)-1] = iterFrame[V]{}
+			it.stack = it.stack[:len(it.stack)-1]
+			continue
+		}
+		f.next = int(k) + 1
+		it.key = append(it.key, k)
+		it.push(child)
+	}
+	it.clearCurrent()
+	return false
+}
+
+func (it *Iterator[V]) clearCurrent() {
+	var zero V
+	it.valid = false
+	it.value = zero
+	it.key = it.key[:0]
+}
+
+// Valid returns true if the iterator is positioned on a key.
+func (it *Iterator[V]) Valid() bool {
+	return it.valid
+}
+
+// Key returns the key the iterator is currently positioned on, or nil if the
+// iterator is not Valid. The key is only valid until the next call to Next, and it
+// should not be modified. If the caller needs access to the key after that, it must
+// copy the key.
+func (it *Iterator[V]) Key() []byte {
+	if !it.valid {
+		return nil
+	}
+	return it.key
+}
+
+// Value returns the value the iterator is currently positioned on, or the zero
+// value if the iterator is not Valid.
+func (it *Iterator[V]) Value() V {
+	return it.value
+}
+
+// Close releases the resources held by the iterator. After Close the iterator is
+// no longer Valid.
+func (it *Iterator[V]) Close() {
+	it.clearCurrent()
+	it.root = nil
+	it.stack = nil
+	it.key = nil
+}
+
+// prevChild returns the child of n with the largest key that is less than end. child is nil
+// if there is no such child.
+func prevChild[V any](n node[V], end int) (k byte, child node[V]) {
+	n.iterateChildrenRangeReverse(0, end, func(ck byte, cn node[V]) WalkState {
+		k, child = ck, cn
+		return Stop
+	})
+	return k, child
+}
+
+// nextChild returns the child of n with the smallest key that is equal to or greater than
+// start. child is nil if there is no such child.
+func nextChild[V any](n node[V], start int) (k byte, child node[V]) {
+	n.iterateChildrenRange(start, 256, func(ck byte, cn node[V]) WalkState {
+		k, child = ck, cn
+		return Stop
+	})
+	return k, child
+}
@@ -0,0 +1,127 @@
+package art
+
+import (
+	"bytes"
+	"testing"
+)
+
+func Test_IteratorEmpty(t *testing.T) {
+	a := new(Tree[int])
+	it := a.Iterator()
+	if it.Valid() {
+		t.Errorf("Iterator on an empty tree should not be valid")
+	}
+	if it.Key() != nil {
+		t.Errorf("Key() should be nil on an invalid iterator, but was %v", it.Key())
+	}
+	if it.Next() {
+		t.Errorf("Next() on an exhausted iterator should return false")
+	}
+}
+
+func Test_IteratorClose(t *testing.T) {
+	a := new(Tree[int])
+	a.Put([]byte{1}, 1)
+	a.Put([]byte{2}, 2)
+	it := a.Iterator()
+	if !it.Valid() {
+		t.Fatalf("Iterator should be valid")
+	}
+	it.Close()
+	if it.Valid() || it.Key() != nil || it.Value() != 0 {
+		t.Errorf("Iterator should not be valid after Close")
+	}
+	if it.Next() {
+		t.Errorf("Next() after Close should return false")
+	}
+}
+
+func Test_IteratorLockstep(t *testing.T) {
+	// merge join 2 trees, which is the sort of thing that can't be done with Walk.
+	a := new(Tree[int])
+	b := new(Tree[int])
+	for i := 0; i < 300; i++ {
+		k := []byte{byte(i / 100), byte(i % 100)}
+		if i%2 == 0 {
+			a.Put(k, i)
+		}
+		if i%3 == 0 {
+			b.Put(k, i)
+		}
+	}
+	ia, ib := a.Iterator(), b.Iterator()
+	matches := 0
+	for ia.Valid() && ib.Valid() {
+		switch bytes.Compare(ia.Key(), ib.Key()) {
+		case -1:
+			ia.Next()
+		case 1:
+			ib.Next()
+		default:
+			if ia.Value()%6 != 0 || ia.Value() != ib.Value() {
+				t.Errorf("Unexpected match for key %v, values %d %d", ia.Key(), ia.Value(), ib.Value())
+			}
+			matches++
+			ia.Next()
+			ib.Next()
+		}
+	}
+	if matches != 50 {
+		t.Errorf("Expecting 50 matching keys, but got %d", matches)
+	}
+}
+
+func Test_IteratorSeek(t *testing.T) {
+	a := new(Tree[int])
+	s := kvStore[int]{}
+	for i := 1; i < 5; i++ {
+		for j := 1; j < 60; j += 3 {
+			e := kv([]byte{byte(i * 2), 10, 11, 12, byte(1 + j*2)}, i*j)
+			a.Put(e.key, e.val)
+			s.put(e)
+		}
+	}
+	a.Put([]byte{4, 10}, 410)
+	s.put(kv([]byte{4, 10}, 410))
+	seeks := [][]byte{
+		{}, {0}, {2}, {3}, {4, 10}, {4, 10, 11}, {4, 10, 11, 12, 50}, {4, 10, 11, 12, 51},
+		{4, 10, 11, 13}, {4, 10, 11, 11}, {4, 9}, {4, 11}, {8, 10, 11, 12, 200}, {9}, {255, 255},
+	}
+	for _, k := range seeks {
+		testSeek(t, a, &s, k)
+	}
+	t.Run("reseek", func(t *testing.T) {
+		it := a.SeekIterator([]byte{9})
+		if it.Valid() {
+			t.Errorf("Iterator should not be valid after seeking past the last key, but is at %v", it.Key())
+		}
+		if !it.Seek([]byte{6, 10, 11, 12, 9}) || !bytes.Equal(it.Key(), []byte{6, 10, 11, 12, 9}) {
+			t.Errorf("Seek to existing key should be positioned at it, but is at %v", it.Key())
+		}
+		if !it.Seek([]byte{2, 10, 11, 12, 3}) || !bytes.Equal(it.Key(), []byte{2, 10, 11, 12, 3}) {
+			t.Errorf("Seek to an earlier key should be positioned at it, but is at %v", it.Key())
+		}
+	})
+}
+
+// testSeek verifies that an Iterator positioned with SeekIterator returns the same keys
+// as the store for all keys >= start.
+func testSeek[V comparable](t *testing.T, a *Tree[V], s *kvStore[V], start []byte) {
+	t.Run("seek "+hexPath(start), func(t *testing.T) {
+		exp := s.orderedRange(start, nil)
+		it := a.SeekIterator(start)
+		defer it.Close()
+		for _, e := range exp {
+			if !it.Valid() {
+				t.Fatalf("Iterator finished early, expecting key %v", e.key)
+			}
+			if !bytes.Equal(e.key, it.Key()) || e.val != it.Value() {
+				t.Fatalf("Iterator at %v / %v but expecting %v / %v", it.Key(), it.Value(), e.key, e.val)
+			}
+			it.Next()
+		}
+		if it.Valid() {
+			t.Errorf("Iterator has unexpected additional key %v", it.Key())
+		}
+	})
+}
@@ -2,6 +2,9 @@ package art
 
 import "fmt"
 
+// leaf holds a value. Leaves don't have a generation, instead they belong to generation 0, see
+// writableBy. So only a tree that has never shared its nodes changes a leaf, any other tree
+// replaces the leaf with a new one.
 type leaf[V any] struct {
 	value V
 	path  keyPath
@@ -11,21 +14,31 @@ func newLeaf[V any](value V) *leaf[V] {
 	return &leaf[V]{value: value}
 }
 
-func newPathLeaf[V any](key []byte, value V) node[V] {
-	l := &leaf[V]{value: value}
-	kend := len(key)
-	kst := max(0, kend-len(l.path.key))
-	l.path.assign(key[kst:kend])
-	key = key[:kst]
-	var curr node[V] = l
-	for len(key) > 0 {
+// newPathLeaf returns a leaf for value with the path key. Any node4s needed to hold the
+// path belong to generation gen.
+func newPathLeaf[V any](gen uint64, key []byte, value V) node[V] {
+	return withPath[V](gen, newLeaf(value), key)
+}
+
+// withPath sets the compressed path of n to path. If the path is too long to fit in the
+// node then intermediate node4s are added above n to hold the rest of the path, in which
+// case the returned node is the top most of these. The added nodes belong to generation gen.
+func withPath[V any](gen uint64, n node[V], path []byte) node[V] {
+	maxLen := len(n.keyPath().key)
+	kend := len(path)
+	kst := max(0, kend-maxLen)
+	n.keyPath().assign(path[kst:kend])
+	path = path[:kst]
+	curr := n
+	for len(path) > 0 {
 		n := &node4[V]{}
-		kend := len(key)
-		n.addChildNode(key[kend-1], curr)
+		n.gen = gen
+		kend := len(path)
+		n.addChildNode(path[kend-1], curr)
 		kend--
-		kst := max(0, kend-len(l.path.key))
-		n.path.assign(key[kst:kend])
-		key = key[:kst]
+		kst := max(0, kend-maxLen)
+		n.path.assign(path[kst:kend])
+		path = path[:kst]
 		curr = n
 	}
 	return curr
@@ -42,6 +55,7 @@ func (l *leaf[V]) header() nodeHeader {
 	return nodeHeader{
 		path:     l.path,
 		hasValue: true,
+		size:     1,
 	}
 }
 
@@ -50,11 +64,21 @@ func (l *leaf[V]) keyPath() *keyPath {
 }
 
 func (l *leaf[V]) grow() node[V] {
-	// we need to promote this leaf to a node with a contained value
+	return l.promote(0)
+}
+
+// promote returns a node4 of generation gen with l's path, and l's value as its value. l
+// is reused as the value if it belongs to gen, or if it has no path.
+func (l *leaf[V]) promote(gen uint64) *node4[V] {
 	n := &node4[V]{}
 	n.path = l.path
-	l.path.assign(nil)
-	n.setNodeValue(l)
+	n.gen = gen
+	v := l
+	if l.path.len > 0 {
+		v = writableBy[V](l, gen).(*leaf[V])
+		v.path.assign(nil)
+	}
+	n.setNodeValue(v)
 	return n
 }
 
@@ -62,6 +86,13 @@ func (l *leaf[V]) shrink() node[V] {
 	return l
 }
 
+// clone returns a new leaf with the same path and value. Leaves don't have a generation,
+// so gen is ignored.
+func (l *leaf[V]) clone(gen uint64) node[V] {
+	c := *l
+	return &c
+}
+
 func (l *leaf[V]) canAddChild() bool {
 	return false
 }
@@ -70,6 +101,10 @@ func (l *leaf[V]) addChildNode(key byte, child node[V]) {
 	panic("Can't add a childNode to a leaf")
 }
 
+func (l *leaf[V]) addSize(delta int) {
+	panic("Can't change the size of a leaf")
+}
+
 func (l *leaf[V]) canSetNodeValue() bool {
 	return true
 }
@@ -90,6 +125,10 @@ func (l *leaf[V]) iterateChildrenRange(start, end int, cb func(k byte, n node[V]
 	return Continue
 }
 
+func (l *leaf[V]) iterateChildrenRangeReverse(start, end int, cb func(k byte, n node[V]) WalkState) WalkState {
+	return Continue
+}
+
 func (l *leaf[V]) removeValue() node[V] {
 	return nil
 }
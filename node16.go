@@ -61,6 +61,7 @@ func (n *node16[V]) addChildNode(key byte, child node[V]) {
 	n.key[slot] = key
 	n.children[slot] = child
 	n.nodeHeader.childCount++
+	n.addSize(sizeOf(child))
 }
 
 func (n *node16[V]) findInsertionPoint(key byte) (idx int, exists bool) {
@@ -82,6 +83,9 @@ func (n *node16[V]) canSetNodeValue() bool {
 
 func (n *node16[V]) setNodeValue(v *leaf[V]) {
 	n.children[n16ValueIdx] = v
+	if !n.hasValue {
+		n.size++
+	}
 	n.hasValue = true
 }
 
@@ -117,9 +121,26 @@ func (n *node16[V]) iterateChildrenRange(start, end int, cb func(k byte, n node[
 	return Continue
 }
 
+func (n *node16[V]) iterateChildrenRangeReverse(start, end int, cb func(k byte, n node[V]) WalkState) WalkState {
+	for i := int(n.childCount) - 1; i >= 0; i-- {
+		k := int(n.key[i])
+		if k >= end {
+			continue
+		}
+		if k < start {
+			return Continue
+		}
+		if cb(n.key[i], n.children[i]) == Stop {
+			return Stop
+		}
+	}
+	return Continue
+}
+
 func (n *node16[V]) removeValue() node[V] {
 	n.children[n16ValueIdx] = nil
 	n.hasValue = false
+	n.size--
 	return n
 }
 
@@ -143,6 +164,12 @@ func (n *node16[V]) shrink() node[V] {
 	return n
 }
 
+func (n *node16[V]) clone(gen uint64) node[V] {
+	c := *n
+	c.gen = gen
+	return &c
+}
+
 func (n *node16[V]) getChildNode(key []byte) *node[V] {
 	// see https://www.superfell.com/weblog/2021/01/it-depends-episode-1
 	// and https://www.superfell.com/weblog/2021/01/it-depends-episode-2
@@ -38,6 +38,7 @@ func (n *node256[V]) canAddChild() bool {
 func (n *node256[V]) addChildNode(key byte, child node[V]) {
 	n.children[key] = child
 	n.childCount++
+	n.addSize(sizeOf(child))
 }
 
 func (n *node256[V]) canSetNodeValue() bool {
@@ -45,6 +46,9 @@ func (n *node256[V]) canSetNodeValue() bool {
 }
 
 func (n *node256[V]) setNodeValue(v *leaf[V]) {
+	if !n.hasValue {
+		n.size++
+	}
 	n.value = v
 	n.hasValue = true
 }
@@ -69,9 +73,22 @@ func (n *node256[V]) iterateChildrenRange(start, end int, cb func(k byte, n node
 	return Continue
 }
 
+func (n *node256[V]) iterateChildrenRangeReverse(start, end int, cb func(k byte, n node[V]) WalkState) WalkState {
+	for k := end - 1; k >= start; k-- {
+		c := n.children[k]
+		if c != nil {
+			if cb(byte(k), c) == Stop {
+				return Stop
+			}
+		}
+	}
+	return Continue
+}
+
 func (n *node256[V]) removeValue() node[V] {
 	n.hasValue = false
 	n.value = nil
+	n.size--
 	return n
 }
 
@@ -87,6 +104,12 @@ func (n *node256[V]) shrink() node[V] {
 	return n
 }
 
+func (n *node256[V]) clone(gen uint64) node[V] {
+	c := *n
+	c.gen = gen
+	return &c
+}
+
 func (n *node256[V]) getChildNode(key []byte) *node[V] {
 	c := n.children[key[0]]
 	if c == nil {
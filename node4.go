@@ -49,6 +49,7 @@ func (n *node4[V]) addChildNode(key byte, child node[V]) {
 	n.key[idx] = key
 	n.children[idx] = child
 	n.nodeHeader.childCount++
+	n.addSize(sizeOf(child))
 }
 
 func (n *node4[V]) canSetNodeValue() bool {
@@ -57,6 +58,9 @@ func (n *node4[V]) canSetNodeValue() bool {
 
 func (n *node4[V]) setNodeValue(v *leaf[V]) {
 	n.children[n4ValueIdx] = v
+	if !n.hasValue {
+		n.size++
+	}
 	n.nodeHeader.hasValue = true
 }
 
@@ -97,9 +101,33 @@ func (n *node4[V]) iterateChildrenRange(start, end int, cb func(k byte, n node[V
 	})
 }
 
+func (n *node4[V]) iterateChildrenRangeReverse(start, end int, cb func(k byte, n node[V]) WalkState) WalkState {
+	limit := end
+	for i := byte(0); i < byte(n.childCount); i++ {
+		next := -1
+		nextIdx := 0
+		for j := 0; j < int(n.childCount); j++ {
+			k := int(n.key[j])
+			if k < limit && k > next {
+				next = k
+				nextIdx = j
+			}
+		}
+		if next < start {
+			return Continue
+		}
+		if cb(byte(next), n.children[nextIdx]) == Stop {
+			return Stop
+		}
+		limit = next
+	}
+	return Continue
+}
+
 func (n *node4[V]) removeValue() node[V] {
 	n.children[n4ValueIdx] = nil
 	n.hasValue = false
+	n.size--
 	return n.shrink()
 }
 
@@ -110,6 +138,7 @@ func (n *node4[V]) shrink() node[V] {
 		c := n.children[0]
 		cp := c.keyPath()
 		if cp.canExtendBy(n.path.len + 1) {
+			c = writableBy(c, n.gen)
 			c.keyPath().prependPath(n.keyPath().asSlice(), n.key[0])
 			return c
 		}
@@ -121,6 +150,7 @@ func (n *node4[V]) shrink() node[V] {
 			v := n.children[n4ValueIdx]
 			vp := v.keyPath()
 			if vp.canExtendBy(n.path.len) {
+				v = writableBy(v, n.gen)
 				v.keyPath().prependPath(n.keyPath().asSlice())
 				return v
 			}
@@ -131,6 +161,12 @@ func (n *node4[V]) shrink() node[V] {
 	return n
 }
 
+func (n *node4[V]) clone(gen uint64) node[V] {
+	c := *n
+	c.gen = gen
+	return &c
+}
+
 func (n *node4[V]) removeChild(k byte) {
 	lastIdx := n.childCount - 1
 	for i := 0; i < int(n.childCount); i++ {
@@ -54,6 +54,7 @@ func (n *node48[V]) addChildNode(key byte, child node[V]) {
 	n.key[key] = byte(n.childCount)
 	n.children[n.childCount] = child
 	n.childCount++
+	n.addSize(sizeOf(child))
 }
 
 func (n *node48[V]) canSetNodeValue() bool {
@@ -62,6 +63,9 @@ func (n *node48[V]) canSetNodeValue() bool {
 
 func (n *node48[V]) setNodeValue(v *leaf[V]) {
 	n.children[n48ValueIdx] = v
+	if !n.hasValue {
+		n.size++
+	}
 	n.hasValue = true
 }
 
@@ -88,9 +92,22 @@ func (n *node48[V]) iterateChildrenRange(start, end int, cb func(k byte, n node[
 	return Continue
 }
 
+func (n *node48[V]) iterateChildrenRangeReverse(start, end int, cb func(k byte, n node[V]) WalkState) WalkState {
+	for k := end - 1; k >= start; k-- {
+		slot := n.key[k]
+		if slot != n48NoChildForKey {
+			if cb(byte(k), n.children[slot]) == Stop {
+				return Stop
+			}
+		}
+	}
+	return Continue
+}
+
 func (n *node48[V]) removeValue() node[V] {
 	n.children[n48ValueIdx] = nil
 	n.hasValue = false
+	n.size--
 	return n
 }
 
@@ -122,6 +139,12 @@ func (n *node48[V]) shrink() node[V] {
 	return n
 }
 
+func (n *node48[V]) clone(gen uint64) node[V] {
+	c := *n
+	c.gen = gen
+	return &c
+}
+
 func (n *node48[V]) getChildNode(key []byte) *node[V] {
 	idx := n.key[key[0]]
 	if idx == n48NoChildForKey {
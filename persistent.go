@@ -0,0 +1,125 @@
+package art
+
+import (
+	"io"
+	"sync/atomic"
+)
+
+// generations is the source of tree generations, each tree that may share nodes with
+// another tree needs a generation that's unique to it.
+var generations uint64
+
+func nextGeneration() uint64 {
+	return atomic.AddUint64(&generations, 1)
+}
+
+// PersistentTree is an immutable Adaptive Radix Tree. Put and Delete don't modify the tree,
+// instead they return a new tree that includes the change. The new tree shares all the nodes
+// that weren't changed with the original tree, only the nodes on the path from the root to
+// the changed key are copied. As a PersistentTree is never modified, it can be read from
+// multiple goroutines without any locking.
+//
+// The zero value is an empty tree ready to use.
+//
+//	v1 := &art.PersistentTree[string]{}
+//	v2 := v1.Put([]byte("a"), "alice")
+//	v3 := v2.Put([]byte("b"), "bob")
+//	// v2 still only contains "a"
+type PersistentTree[V any] struct {
+	tree Tree[V]
+}
+
+// Snapshot returns a read only view of the tree as it is now. Taking a snapshot is O(1) as the
+// snapshot shares all the nodes of the tree. Subsequent changes to the tree copy any shared nodes
+// that they change, so the snapshot is unaffected by them. The snapshot can be read from other
+// goroutines while the tree continues to be modified, however the call to Snapshot itself must
+// not be concurrent with changes to the tree.
+func (a *Tree[V]) Snapshot() *PersistentTree[V] {
+	s := &PersistentTree[V]{tree: *a}
+	a.gen = nextGeneration()
+	return s
+}
+
+// edit returns a copy of p that shares all of p's nodes, but has a new generation, so any
+// changes to it copy the nodes that it changes.
+func (p *PersistentTree[V]) edit() *PersistentTree[V] {
+	e := &PersistentTree[V]{tree: p.tree}
+	e.tree.gen = nextGeneration()
+	return e
+}
+
+// Put returns a new tree that has value associated with key, p is unchanged.
+func (p *PersistentTree[V]) Put(key []byte, value V) *PersistentTree[V] {
+	e := p.edit()
+	e.tree.Put(key, value)
+	return e
+}
+
+// Delete returns a new tree that doesn't contain key, p is unchanged. If key isn't in the tree,
+// then p itself is returned.
+func (p *PersistentTree[V]) Delete(key []byte) *PersistentTree[V] {
+	if _, exists := p.tree.Get(key); !exists {
+		return p
+	}
+	e := p.edit()
+	e.tree.Delete(key)
+	return e
+}
+
+// Apply returns a new tree with all the operations in the batch applied to it, p is unchanged.
+func (p *PersistentTree[V]) Apply(b *Batch[V]) *PersistentTree[V] {
+	e := p.edit()
+	e.tree.Apply(b)
+	return e
+}
+
+// Get the value for the provided key. exists is true if the key contains a value in the tree,
+// false otherwise.
+func (p *PersistentTree[V]) Get(key []byte) (value V, exists bool) {
+	return p.tree.Get(key)
+}
+
+// Len returns the number of keys in the tree.
+func (p *PersistentTree[V]) Len() int {
+	return p.tree.Len()
+}
+
+// Walk will call the provided callback function with each key/value pair, in key order.
+// See Tree.Walk for more details.
+func (p *PersistentTree[V]) Walk(callback func(key []byte, value V) WalkState) {
+	p.tree.Walk(callback)
+}
+
+// WalkRange will call the provided callback function with each key/value pair in the range,
+// in key order. See Tree.WalkRange for more details.
+func (p *PersistentTree[V]) WalkRange(start []byte, end []byte, callback func(key []byte, value V) WalkState) {
+	p.tree.WalkRange(start, end, callback)
+}
+
+// WalkPrefix will call the provided callback function with each key/value pair whose key starts
+// with prefix, in key order.
+func (p *PersistentTree[V]) WalkPrefix(prefix []byte, callback func(key []byte, value V) WalkState) {
+	p.tree.WalkPrefix(prefix, callback)
+}
+
+// Iterator returns a new Iterator positioned at the first key in the tree. As the tree can't
+// be modified, the Iterator remains valid regardless of any Puts or Deletes.
+func (p *PersistentTree[V]) Iterator() *Iterator[V] {
+	return p.tree.Iterator()
+}
+
+// SeekIterator returns a new Iterator positioned at the first key that is equal to or
+// greater than key.
+func (p *PersistentTree[V]) SeekIterator(key []byte) *Iterator[V] {
+	return p.tree.SeekIterator(key)
+}
+
+// Stats returns current statistics about the nodes & keys in the tree.
+func (p *PersistentTree[V]) Stats() *Stats {
+	return p.tree.Stats()
+}
+
+// PrettyPrint will write a text representation of the tree structure to the supplied writer.
+func (p *PersistentTree[V]) PrettyPrint(w io.Writer) {
+	p.tree.PrettyPrint(w)
+}
@@ -0,0 +1,178 @@
+package art
+
+import (
+	"bytes"
+	"math/rand"
+	"testing"
+)
+
+func Test_PersistentTree(t *testing.T) {
+	type version struct {
+		tree *PersistentTree[int]
+		exp  []keyVal[int]
+	}
+	s := &kvStore[int]{}
+	p := &PersistentTree[int]{}
+	versions := []version{{p, nil}}
+	keys := make([][]byte, 0, 500)
+	for i := 0; i < 1000; i++ {
+		if len(keys) > 0 && rand.Intn(4) == 0 {
+			k := keys[rand.Intn(len(keys))]
+			p = p.Delete(k)
+			s.delete(k)
+		} else {
+			k := rndKey()
+			keys = append(keys, k)
+			p = p.Put(k, i)
+			s.put(kv(k, i))
+		}
+		if i%50 == 0 {
+			versions = append(versions, version{p, append([]keyVal[int](nil), s.ordered()...)})
+		}
+	}
+	for _, v := range versions {
+		hasKeyVals(t, &v.tree.tree, v.exp)
+	}
+}
+
+func Test_PersistentTreeDeleteMissing(t *testing.T) {
+	p := (&PersistentTree[int]{}).Put([]byte{1}, 1)
+	if d := p.Delete([]byte{2}); d != p {
+		t.Errorf("Delete of a key not in the tree should return the same tree")
+	}
+	d := p.Delete([]byte{1})
+	if d.Len() != 0 || p.Len() != 1 {
+		t.Errorf("Delete should return a new tree with the key removed, got Len %d and original Len %d", d.Len(), p.Len())
+	}
+}
+
+// Test_SharedTreeUnchanged checks that each of the ways of modifying a tree only changes
+// nodes that belong to its generation, and copies any others.
+func Test_SharedTreeUnchanged(t *testing.T) {
+	build := func() *Tree[int] {
+		a := new(Tree[int])
+		for i := 0; i < 300; i++ {
+			a.Put([]byte{byte(i % 7), byte(i % 3), 1, 2, 3, byte(i)}, i)
+		}
+		for _, k := range [][]byte{nil, {1}, {1, 1}, {1, 1, 1}, {2, 2, 1, 2}, {6, 0xFF}, bytes.Repeat([]byte{9}, 60)} {
+			a.Put(k, len(k))
+		}
+		for i := 0; i < 64; i++ {
+			a.Put([]byte{8, byte(i * 3)}, i)
+		}
+		return a
+	}
+	ops := map[string]func(a *Tree[int]){
+		"Put new":            func(a *Tree[int]) { a.Put([]byte{1, 1, 1, 2, 3, 0xFF}, -1) },
+		"Put existing":       func(a *Tree[int]) { a.Put([]byte{1, 1, 1, 2, 3, 1}, -1) },
+		"Put splits path":    func(a *Tree[int]) { a.Put([]byte{1, 1, 1, 5}, -1) },
+		"Put long":           func(a *Tree[int]) { a.Put(append(bytes.Repeat([]byte{9}, 40), 1), -1) },
+		"Put node value":     func(a *Tree[int]) { a.Put([]byte{8}, -1) },
+		"Put grows":          func(a *Tree[int]) { a.Put([]byte{8, 1}, -1) },
+		"Swap":               func(a *Tree[int]) { a.Swap([]byte{1, 1}, -1) },
+		"LoadOrStore":        func(a *Tree[int]) { a.LoadOrStore([]byte{1, 1, 9}, -1) },
+		"Update":             func(a *Tree[int]) { a.Update([]byte{1}, func(v int, _ bool) (int, bool) { return v + 1, true }) },
+		"Update removes":     func(a *Tree[int]) { a.Update([]byte{1, 1}, func(v int, _ bool) (int, bool) { return v, false }) },
+		"Update adds":        func(a *Tree[int]) { a.Update([]byte{7}, func(v int, _ bool) (int, bool) { return 7, true }) },
+		"Delete node value":  func(a *Tree[int]) { a.Delete([]byte{1, 1}) },
+		"Delete shrinks":     func(a *Tree[int]) { a.Delete([]byte{6, 0xFF}) },
+		"Delete long":        func(a *Tree[int]) { a.Delete(bytes.Repeat([]byte{9}, 60)) },
+		"DeletePrefix":       func(a *Tree[int]) { a.DeletePrefix([]byte{2}) },
+		"DeletePrefix inner": func(a *Tree[int]) { a.DeletePrefix([]byte{1, 1, 1, 2, 3, 0x10}) },
+		"DeleteRange":        func(a *Tree[int]) { a.DeleteRange([]byte{1, 1, 1, 2, 3, 0x10}, []byte{3, 0}) },
+		"DeleteRange n256":   func(a *Tree[int]) { a.DeleteRange([]byte{8, 10}, []byte{8, 150}) },
+		"Apply": func(a *Tree[int]) {
+			b := Batch[int]{}
+			b.Put([]byte{1, 1, 1, 2, 3, 0xFF}, -1)
+			b.Put([]byte{1, 1, 1, 2, 3, 1}, -2)
+			b.Delete([]byte{1, 1, 1, 2, 3, 8})
+			b.Delete([]byte{6, 0xFF})
+			b.Put([]byte{8, 1}, -3)
+			b.Delete([]byte{2, 2, 1, 2})
+			b.Put([]byte{1, 1, 4}, -4)
+			a.Apply(&b)
+		},
+		"Delete each": func(a *Tree[int]) {
+			a.Walk(func(k []byte, _ int) WalkState {
+				c := *a
+				c.gen = nextGeneration()
+				c.Delete(k)
+				return Continue
+			})
+		},
+	}
+	for name, op := range ops {
+		t.Run(name, func(t *testing.T) {
+			a := build()
+			before := pretty(a)
+			beforeKVs := collect(a)
+			shared := *a
+			shared.gen = nextGeneration()
+			op(&shared)
+			if after := pretty(a); after != before {
+				t.Errorf("Original tree was modified, was\n%s\nnow\n%s", before, after)
+			}
+			hasKeyVals(t, a, beforeKVs)
+			// the copy should end up the same as doing the op on an unshared tree
+			exp := build()
+			op(exp)
+			hasKeyVals(t, &shared, collect(exp))
+			if shared.Len() != exp.Len() {
+				t.Errorf("Expecting Len() of %d, but was %d", exp.Len(), shared.Len())
+			}
+		})
+	}
+}
+
+func collect[V any](a *Tree[V]) []keyVal[V] {
+	var r []keyVal[V]
+	a.Walk(func(k []byte, v V) WalkState {
+		r = append(r, kv(append([]byte(nil), k...), v))
+		return Continue
+	})
+	return r
+}
+
+func Test_Snapshot(t *testing.T) {
+	a := new(Tree[int])
+	s := &kvStore[int]{}
+	for i := 0; i < 500; i++ {
+		k := rndKey()
+		a.Put(k, i)
+		s.put(kv(k, i))
+	}
+	exp := append([]keyVal[int](nil), s.ordered()...)
+	snap := a.Snapshot()
+	done := make(chan struct{})
+	go func() {
+		// read the snapshot while the tree is being changed, go test -race will
+		// report any writes to nodes the snapshot can see.
+		defer close(done)
+		for i := 0; i < 5; i++ {
+			hasKeyVals(t, &snap.tree, exp)
+		}
+	}()
+	for i, e := range exp {
+		if i%2 == 0 {
+			a.Delete(e.key)
+			s.delete(e.key)
+		} else {
+			a.Put(e.key, -i)
+			s.put(kv(e.key, -i))
+		}
+		k := rndKey()
+		a.Put(k, i)
+		s.put(kv(k, i))
+	}
+	<-done
+	hasKeyVals(t, &snap.tree, exp)
+	hasKeyVals(t, a, s.ordered())
+
+	// a second snapshot sees the changes, and isn't affected by changes to the first
+	snap2 := a.Snapshot()
+	snap3 := snap2.Put([]byte{1, 2, 3}, 42)
+	a.Delete([]byte{1, 2, 3})
+	hasKeyVals(t, &snap2.tree, s.ordered())
+	s.put(kv([]byte{1, 2, 3}, 42))
+	hasKeyVals(t, &snap3.tree, s.ordered())
+}
@@ -0,0 +1,712 @@
+package art
+
+import (
+	"bytes"
+	"runtime"
+	"sync"
+	"sync/atomic"
+	"unsafe"
+)
+
+// RowexTree is an Adaptive Radix Tree that is safe for concurrent use by multiple goroutines, and is
+// optimized for workloads that are mostly reads. It follows the read-optimized write exclusion (ROWEX)
+// approach from "The ART of Practical Synchronization" https://db.in.tum.de/~leis/papers/artsync.pdf.
+// Each node has a lock that's taken by writers that change it, while readers never block, take locks,
+// or restart.
+//
+// Writers change nodes in place, using atomic stores in an order that means a reader always sees a
+// usable node. Adding a child to a node4, node16 or node48 uses the next unused slot, and removing a
+// child clears its slot, so a slot is never reused for a different key. When a node runs out of slots,
+// or needs to grow or shrink, a new node is built and atomically swapped into the parent, which
+// requires the parent to be locked as well, and the old node is marked obsolete. When a compressed
+// path is split, the new node above it is swapped into the parent, and then the node's path is
+// atomically replaced with the rest of the path. A reader that got to the node before the split may
+// then see a path that's shorter than it expects, so leaves hold the full key, and a reader only skips
+// over the missing part of the path, and checks the full key once it gets to the leaf.
+//
+// Writers find the nodes to change in the same way as readers, and then lock them, always locking a
+// parent before its child. A writer restarts if a node it locked has become obsolete, or has changed
+// in a way that affects the change being made.
+//
+// The zero value is an empty tree ready to use.
+type RowexTree[V any] struct {
+	// size is first so that it's 64 bit aligned for atomic access on 32 bit platforms.
+	size int64
+	// the *rnode[V] root, this is created by the first Put and then never replaced.
+	root unsafe.Pointer
+}
+
+// rnode is an inner node of a RowexTree. Like ConcurrentTree the node type is determined by the
+// number of children there's space for, and the value is kept separately from the children.
+type rnode[V any] struct {
+	// always false, this is how a node is told apart from a leaf.
+	isLeaf bool
+	// set once the node has been replaced in the tree. Only read and written with mu held.
+	obsolete bool
+	// held by writers that change the node.
+	mu sync.Mutex
+	// the length of the key up to the end of this node's path, which is the index of the key
+	// byte for its children. This doesn't change when the path is split, as that removes the
+	// start of the path, or when a parent's path is merged into it, as that adds to the start.
+	level int
+	// the compressed path, a *keyPath. It's replaced rather than modified.
+	path unsafe.Pointer
+	// the value for the key that ends at this node, a *rleaf[V] or nil.
+	value unsafe.Pointer
+	// the number of child slots that have been used. Slots aren't reused when a child is
+	// removed. Nodes with 256 children use the key byte as the slot so don't use this.
+	used int32
+	// the number of children.
+	live int32
+	// the keys for the children, packed 4 to a word. For nodes with up to 16 children key i
+	// is for slot i. For 48 children the key byte is the index, and the key is the slot + 1,
+	// or 0 for no child. Nodes with 256 children don't need keys.
+	keys []uint32
+	// each child is either a *rnode[V] or a *rleaf[V].
+	children []unsafe.Pointer
+}
+
+// rleaf is a leaf of a RowexTree. It's never changed once it's in the tree.
+type rleaf[V any] struct {
+	// always true
+	isLeaf bool
+	// the full key, not just the remaining part of it.
+	key   []byte
+	value V
+}
+
+// rchild is a child of an rnode, along with its key.
+type rchild struct {
+	key byte
+	n   unsafe.Pointer
+}
+
+// Put inserts or updates a value in the tree associated with the provided key.
+func (r *RowexTree[V]) Put(key []byte, value V) {
+	for !r.put(key, value) {
+		runtime.Gosched()
+	}
+}
+
+// put returns false if a concurrent change was detected, in which case it should be restarted.
+func (r *RowexTree[V]) put(key []byte, value V) bool {
+	n := r.loadRoot()
+	var parent *rnode[V]
+	depth := 0
+	for {
+		p := n.loadPath()
+		if int(p.len) != n.level-depth {
+			// n's path is being split or merged, see get. Unlike readers, writers need the
+			// whole path to match.
+			return false
+		}
+		path := p.asSlice()
+		prefixLen := prefixSize(key[depth:], path)
+		if prefixLen < len(path) {
+			// key diverges part way through n's path. A new node4 with the shared part of the
+			// path is swapped in to the parent, after which n's path is trimmed to the rest.
+			if !lockWithParent(parent, key[parent.level], n) {
+				return false
+			}
+			if n.path != unsafe.Pointer(p) {
+				n.unlock()
+				parent.unlock()
+				return false
+			}
+			split := newRNode[V](4, depth+prefixLen, path[:prefixLen])
+			split.addChild(path[prefixLen], unsafe.Pointer(n))
+			split.insert(newRLeaf(key, value))
+			parent.replaceChild(key[parent.level], unsafe.Pointer(split))
+			n.storePath(path[prefixLen+1:])
+			n.unlock()
+			parent.unlock()
+			atomic.AddInt64(&r.size, 1)
+			return true
+		}
+		depth = n.level
+		if depth == len(key) {
+			if !n.lock() {
+				return false
+			}
+			if n.value == nil {
+				atomic.AddInt64(&r.size, 1)
+			}
+			atomic.StorePointer(&n.value, unsafe.Pointer(newRLeaf(key, value)))
+			n.unlock()
+			return true
+		}
+		child := n.child(key[depth])
+		if child == nil {
+			// a full node is replaced, which needs the parent to be locked as well. The root
+			// has 256 children so is never full.
+			full := n.full()
+			if full && !lockWithParent(parent, key[parent.level], n) || !full && !n.lock() {
+				return false
+			}
+			if n.child(key[depth]) != nil || n.full() != full {
+				n.unlock()
+				if full {
+					parent.unlock()
+				}
+				return false
+			}
+			if full {
+				g := n.resized(rnodeCapacity(int(n.live) + 1))
+				g.insert(newRLeaf(key, value))
+				parent.replaceChild(key[parent.level], unsafe.Pointer(g))
+				n.unlockObsolete()
+				parent.unlock()
+			} else {
+				n.insert(newRLeaf(key, value))
+				n.unlock()
+			}
+			atomic.AddInt64(&r.size, 1)
+			return true
+		}
+		if l := asRLeaf[V](child); l != nil {
+			if !n.lock() {
+				return false
+			}
+			if n.child(key[depth]) != child {
+				n.unlock()
+				return false
+			}
+			if bytes.Equal(l.key, key) {
+				n.replaceChild(key[depth], unsafe.Pointer(newRLeaf(key, value)))
+			} else {
+				n.replaceChild(key[depth], splitRLeaf(l, newRLeaf(key, value), depth+1))
+				atomic.AddInt64(&r.size, 1)
+			}
+			n.unlock()
+			return true
+		}
+		parent = n
+		n = (*rnode[V])(child)
+		depth++
+	}
+}
+
+// loadRoot returns the root node, creating it if needed.
+func (r *RowexTree[V]) loadRoot() *rnode[V] {
+	if n := atomic.LoadPointer(&r.root); n != nil {
+		return (*rnode[V])(n)
+	}
+	atomic.CompareAndSwapPointer(&r.root, nil, unsafe.Pointer(newRNode[V](256, 0, nil)))
+	return (*rnode[V])(atomic.LoadPointer(&r.root))
+}
+
+// splitRLeaf returns a new node4 that contains the leaves a and b, whose keys are the same up to
+// depth. If the rest of the keys have more in common than fits in a path, then the node4 has a
+// single child that's another node4 for the rest.
+func splitRLeaf[V any](a, b *rleaf[V], depth int) unsafe.Pointer {
+	common := prefixSize(a.key[depth:], b.key[depth:])
+	if maxLen := len(keyPath{}.key); common > maxLen {
+		n := newRNode[V](4, depth+maxLen, b.key[depth:depth+maxLen])
+		n.addChild(b.key[depth+maxLen], splitRLeaf(a, b, depth+maxLen+1))
+		return unsafe.Pointer(n)
+	}
+	n := newRNode[V](4, depth+common, b.key[depth:depth+common])
+	n.insert(a)
+	n.insert(b)
+	return unsafe.Pointer(n)
+}
+
+// Delete removes the value associated with the supplied key if it exists.
+func (r *RowexTree[V]) Delete(key []byte) {
+	for !r.delete(key) {
+		runtime.Gosched()
+	}
+}
+
+// delete returns false if a concurrent change was detected, or if a node on the path to key was
+// shrunk, in which case it should be restarted.
+func (r *RowexTree[V]) delete(key []byte) bool {
+	n := (*rnode[V])(atomic.LoadPointer(&r.root))
+	if n == nil {
+		return true
+	}
+	var parent *rnode[V]
+	depth := 0
+	for {
+		p := n.loadPath()
+		if int(p.len) != n.level-depth {
+			return false
+		}
+		if parent != nil && n.shrinkable() {
+			// removing a key from one of n's children has left n with too few entries, see remove.
+			if lockWithParent(parent, key[parent.level], n) {
+				replaceShrunk(parent, key[parent.level], n)
+				parent.unlock()
+			}
+			return false
+		}
+		if !bytes.HasPrefix(key[depth:], p.asSlice()) {
+			return true
+		}
+		depth = n.level
+		var l *rleaf[V]
+		if depth == len(key) {
+			l = n.loadValue()
+		} else if child := n.child(key[depth]); child == nil {
+			return true
+		} else if l = asRLeaf[V](child); l == nil {
+			parent = n
+			n = (*rnode[V])(child)
+			depth++
+			continue
+		}
+		if l == nil || !bytes.Equal(l.key, key) {
+			return true
+		}
+		return r.remove(parent, n, l)
+	}
+}
+
+// remove removes the leaf l from n, and replaces n in its parent if that leaves n with too few
+// entries. It returns false if a concurrent change was detected, or if the parent now has too few
+// entries as well, in which case the delete should be restarted, which will shrink the parent.
+func (r *RowexTree[V]) remove(parent, n *rnode[V], l *rleaf[V]) bool {
+	if parent == nil {
+		n.lock() // the root is never obsolete.
+	} else if !lockWithParent(parent, l.key[parent.level], n) {
+		return false
+	}
+	isChild := len(l.key) > n.level
+	if !isChild && n.loadValue() != l || isChild && n.child(l.key[n.level]) != unsafe.Pointer(l) {
+		n.unlock()
+		if parent != nil {
+			parent.unlock()
+		}
+		return false
+	}
+	if isChild {
+		n.removeChild(l.key[n.level])
+	} else {
+		atomic.StorePointer(&n.value, nil)
+	}
+	atomic.AddInt64(&r.size, -1)
+	if parent == nil {
+		n.unlock()
+		return true
+	}
+	replaceShrunk(parent, l.key[parent.level], n)
+	// the root is the only node with level 0, and is never replaced.
+	done := parent.level == 0 || !parent.shrinkable()
+	parent.unlock()
+	return done
+}
+
+// replaceShrunk replaces n, which is parent's child for key k, with the result of shrunk if that's
+// different to n. Both must be locked, n is unlocked.
+func replaceShrunk[V any](parent *rnode[V], k byte, n *rnode[V]) {
+	s := n.shrunk()
+	switch s {
+	case unsafe.Pointer(n):
+		n.unlock()
+		return
+	case nil:
+		parent.removeChild(k)
+	default:
+		parent.replaceChild(k, s)
+	}
+	n.unlockObsolete()
+}
+
+// Get the value for the provided key. exists is true if the key contains a value in the tree,
+// false otherwise.
+func (r *RowexTree[V]) Get(key []byte) (value V, exists bool) {
+	n := (*rnode[V])(atomic.LoadPointer(&r.root))
+	if n == nil {
+		return value, false
+	}
+	return n.get(key, 0)
+}
+
+// get returns the value for key from n, which was reached after depth bytes of the key.
+func (n *rnode[V]) get(key []byte, depth int) (value V, exists bool) {
+	for {
+		if len(key) < n.level {
+			return value, false
+		}
+		// the path is compared with the part of the key that it should match. It may be longer
+		// than that if it's not been trimmed yet after a split, or shorter if it's been trimmed
+		// since this reader got to the node, in which case the rest of the key is checked at the leaf.
+		path := n.loadPath().asSlice()
+		if want := n.level - depth; len(path) > want {
+			path = path[len(path)-want:]
+		}
+		if !bytes.Equal(key[n.level-len(path):n.level], path) {
+			return value, false
+		}
+		depth = n.level
+		var l *rleaf[V]
+		if depth == len(key) {
+			l = n.loadValue()
+		} else {
+			child := n.child(key[depth])
+			if child == nil {
+				return value, false
+			}
+			if l = asRLeaf[V](child); l == nil {
+				n = (*rnode[V])(child)
+				depth++
+				continue
+			}
+		}
+		if l == nil || !bytes.Equal(l.key, key) {
+			return value, false
+		}
+		return l.value, true
+	}
+}
+
+// Len returns the number of keys in the tree.
+func (r *RowexTree[V]) Len() int {
+	return int(atomic.LoadInt64(&r.size))
+}
+
+// Walk will call the provided callback function with each key/value pair, in key order. Walk
+// doesn't block writers, and the callback is free to modify the tree. Keys that are changed while
+// the walk is running may or may not be seen by the walk. The key passed to the callback is a copy,
+// that's only valid for the duration of the callback.
+func (r *RowexTree[V]) Walk(callback func(key []byte, value V) WalkState) {
+	if n := (*rnode[V])(atomic.LoadPointer(&r.root)); n != nil {
+		n.walk(make([]byte, 0, 32), callback)
+	}
+}
+
+// walk calls callback for each value in n. buf is used for the copy of each key, as the leaf's
+// own key is shared with readers.
+func (n *rnode[V]) walk(buf []byte, callback func(key []byte, value V) WalkState) WalkState {
+	if l := n.loadValue(); l != nil && callback(append(buf[:0], l.key...), l.value) == Stop {
+		return Stop
+	}
+	for _, c := range n.sortedChildren() {
+		if l := asRLeaf[V](c.n); l != nil {
+			if callback(append(buf[:0], l.key...), l.value) == Stop {
+				return Stop
+			}
+		} else if (*rnode[V])(c.n).walk(buf, callback) == Stop {
+			return Stop
+		}
+	}
+	return Continue
+}
+
+func newRNode[V any](capacity, level int, path []byte) *rnode[V] {
+	n := &rnode[V]{level: level, keys: newKeys(capacity), children: make([]unsafe.Pointer, capacity)}
+	n.storePath(path)
+	return n
+}
+
+func newRLeaf[V any](key []byte, value V) *rleaf[V] {
+	k := make([]byte, len(key))
+	copy(k, key)
+	return &rleaf[V]{isLeaf: true, key: k, value: value}
+}
+
+// asRLeaf returns the child c as a leaf, or nil if it's an rnode.
+func asRLeaf[V any](c unsafe.Pointer) *rleaf[V] {
+	if *(*bool)(c) {
+		return (*rleaf[V])(c)
+	}
+	return nil
+}
+
+// rnodeCapacity returns the capacity of the smallest node type that can hold count children.
+func rnodeCapacity(count int) int {
+	switch {
+	case count <= 4:
+		return 4
+	case count <= 16:
+		return 16
+	case count <= 48:
+		return 48
+	}
+	return 256
+}
+
+func (n *rnode[V]) loadPath() *keyPath {
+	return (*keyPath)(atomic.LoadPointer(&n.path))
+}
+
+func (n *rnode[V]) storePath(path []byte) {
+	p := &keyPath{}
+	p.assign(path)
+	atomic.StorePointer(&n.path, unsafe.Pointer(p))
+}
+
+func (n *rnode[V]) loadValue() *rleaf[V] {
+	return (*rleaf[V])(atomic.LoadPointer(&n.value))
+}
+
+// child returns the child for key k, or nil if there isn't one.
+func (n *rnode[V]) child(k byte) unsafe.Pointer {
+	switch len(n.children) {
+	case 256:
+		return atomic.LoadPointer(&n.children[k])
+	case 48:
+		if i := loadKey(n.keys, int(k)); i > 0 {
+			return atomic.LoadPointer(&n.children[i-1])
+		}
+		return nil
+	}
+	// a removed child leaves its key in place, and the key may have been added again in a
+	// later slot.
+	used := int(atomic.LoadInt32(&n.used))
+	for i := 0; i < used; i++ {
+		if loadKey(n.keys, i) == k {
+			if c := atomic.LoadPointer(&n.children[i]); c != nil {
+				return c
+			}
+		}
+	}
+	return nil
+}
+
+// sortedChildren returns n's children in key order. Children that are added or removed while this
+// is running may or may not be included.
+func (n *rnode[V]) sortedChildren() []rchild {
+	var children []rchild
+	switch len(n.children) {
+	case 256:
+		for k := range n.children {
+			if c := atomic.LoadPointer(&n.children[k]); c != nil {
+				children = append(children, rchild{byte(k), c})
+			}
+		}
+	case 48:
+		for k := 0; k < 256; k++ {
+			if i := loadKey(n.keys, k); i > 0 {
+				if c := atomic.LoadPointer(&n.children[i-1]); c != nil {
+					children = append(children, rchild{byte(k), c})
+				}
+			}
+		}
+	default:
+		used := int(atomic.LoadInt32(&n.used))
+		for i := 0; i < used; i++ {
+			if c := atomic.LoadPointer(&n.children[i]); c != nil {
+				children = append(children, rchild{loadKey(n.keys, i), c})
+			}
+		}
+		// insertion sort, which keeps the slot order for a key that was removed and then added
+		// again while this was running, so that the later slot is used.
+		for i := 1; i < len(children); i++ {
+			for j := i; j > 0 && children[j-1].key > children[j].key; j-- {
+				children[j-1], children[j] = children[j], children[j-1]
+			}
+		}
+		last := 0
+		for i := 1; i < len(children); i++ {
+			if children[i].key != children[last].key {
+				last++
+			}
+			children[last] = children[i]
+		}
+		if len(children) > 0 {
+			children = children[:last+1]
+		}
+	}
+	return children
+}
+
+// full returns true if there's no slot for another child.
+func (n *rnode[V]) full() bool {
+	return len(n.children) != 256 && int(atomic.LoadInt32(&n.used)) == len(n.children)
+}
+
+// onlyChild returns n's child if it has exactly one, otherwise nil.
+func (n *rnode[V]) onlyChild() (c rchild) {
+	count := 0
+	each := func(k byte, child unsafe.Pointer) {
+		if child != nil {
+			c = rchild{k, child}
+			count++
+		}
+	}
+	switch len(n.children) {
+	case 256:
+		for k := range n.children {
+			each(byte(k), atomic.LoadPointer(&n.children[k]))
+		}
+	case 48:
+		for k := 0; k < 256; k++ {
+			if i := loadKey(n.keys, k); i > 0 {
+				each(byte(k), atomic.LoadPointer(&n.children[i-1]))
+			}
+		}
+	default:
+		used := int(atomic.LoadInt32(&n.used))
+		for i := 0; i < used; i++ {
+			each(loadKey(n.keys, i), atomic.LoadPointer(&n.children[i]))
+		}
+	}
+	if count != 1 {
+		return rchild{}
+	}
+	return c
+}
+
+// shrinkable returns true if n should be replaced with the result of shrunk. It can be called
+// without n being locked, in which case the result may be out of date by the time it's used.
+func (n *rnode[V]) shrinkable() bool {
+	live := int(atomic.LoadInt32(&n.live))
+	switch {
+	case live == 0:
+		return true
+	case live == 1 && n.loadValue() == nil:
+		c := n.onlyChild()
+		if c.n == nil {
+			return false
+		}
+		if asRLeaf[V](c.n) != nil {
+			return true
+		}
+		if (*rnode[V])(c.n).loadPath().canExtendBy(n.loadPath().len + 1) {
+			return true
+		}
+	}
+	return shrunkCapacity(len(n.children), live) != 0
+}
+
+// The remaining methods change the node, they must only be called by a writer.
+
+// lock locks the node. It returns false if the node has been replaced, in which case it's not
+// locked.
+func (n *rnode[V]) lock() bool {
+	n.mu.Lock()
+	if n.obsolete {
+		n.mu.Unlock()
+		return false
+	}
+	return true
+}
+
+func (n *rnode[V]) unlock() {
+	n.mu.Unlock()
+}
+
+// unlockObsolete marks the node as obsolete and unlocks it, this should be done once it's been
+// replaced in the tree.
+func (n *rnode[V]) unlockObsolete() {
+	n.obsolete = true
+	n.mu.Unlock()
+}
+
+// lockWithParent locks parent and then n. It returns false if either has been replaced, or n is
+// no longer parent's child for key k, in which case neither is locked.
+func lockWithParent[V any](parent *rnode[V], k byte, n *rnode[V]) bool {
+	if !parent.lock() {
+		return false
+	}
+	if parent.child(k) != unsafe.Pointer(n) || !n.lock() {
+		parent.unlock()
+		return false
+	}
+	return true
+}
+
+// insert adds the leaf l to n, either as its value or as a child. n must not have an existing
+// value or child for the leaf's key, and must have a slot for it.
+func (n *rnode[V]) insert(l *rleaf[V]) {
+	if len(l.key) == n.level {
+		atomic.StorePointer(&n.value, unsafe.Pointer(l))
+		return
+	}
+	n.addChild(l.key[n.level], unsafe.Pointer(l))
+}
+
+func (n *rnode[V]) addChild(k byte, c unsafe.Pointer) {
+	switch len(n.children) {
+	case 256:
+		atomic.StorePointer(&n.children[k], c)
+	case 48:
+		atomic.StorePointer(&n.children[n.used], c)
+		storeKey(n.keys, int(k), byte(n.used+1))
+		atomic.StoreInt32(&n.used, n.used+1)
+	default:
+		// the child and key are set before the slot is included in used.
+		atomic.StorePointer(&n.children[n.used], c)
+		storeKey(n.keys, int(n.used), k)
+		atomic.StoreInt32(&n.used, n.used+1)
+	}
+	atomic.AddInt32(&n.live, 1)
+}
+
+// slot returns the index into children of the child for key k, which must exist.
+func (n *rnode[V]) slot(k byte) int {
+	switch len(n.children) {
+	case 256:
+		return int(k)
+	case 48:
+		return int(loadKey(n.keys, int(k))) - 1
+	}
+	for i := 0; i < int(n.used); i++ {
+		if loadKey(n.keys, i) == k && n.children[i] != nil {
+			return i
+		}
+	}
+	panic("slot called for a key with no child")
+}
+
+func (n *rnode[V]) replaceChild(k byte, c unsafe.Pointer) {
+	atomic.StorePointer(&n.children[n.slot(k)], c)
+}
+
+func (n *rnode[V]) removeChild(k byte) {
+	i := n.slot(k)
+	if len(n.children) == 48 {
+		storeKey(n.keys, int(k), 0)
+	}
+	atomic.StorePointer(&n.children[i], nil)
+	atomic.AddInt32(&n.live, -1)
+}
+
+// resized returns a new node with space for capacity children, that has the same path, value
+// and children as n.
+func (n *rnode[V]) resized(capacity int) *rnode[V] {
+	r := &rnode[V]{
+		level:    n.level,
+		path:     n.path,
+		value:    n.value,
+		keys:     newKeys(capacity),
+		children: make([]unsafe.Pointer, capacity),
+	}
+	for _, c := range n.sortedChildren() {
+		r.addChild(c.key, c.n)
+	}
+	return r
+}
+
+// shrunk returns the node that should replace n after something has been removed from it. This is
+// nil if n is empty, n's value leaf if it has no children, or its only child if it has no value.
+// Otherwise it's a smaller node if n has few enough children, or n itself.
+func (n *rnode[V]) shrunk() unsafe.Pointer {
+	switch {
+	case n.live == 0:
+		// as the leaf has the full key it can be moved up to the parent as is.
+		return n.value
+	case n.live == 1 && n.value == nil:
+		c := n.onlyChild()
+		if asRLeaf[V](c.n) != nil {
+			return c.n
+		}
+		// the child needs our path and its key adding to the start of its path, which needs it
+		// to be locked. It can't be obsolete as n is locked. The child's path is changed first,
+		// readers that get to it from n will only compare the end of the path.
+		child := (*rnode[V])(c.n)
+		path, childPath := n.loadPath(), *child.loadPath()
+		if childPath.canExtendBy(path.len + 1) {
+			child.lock()
+			childPath.prependPath(path.asSlice(), c.key)
+			atomic.StorePointer(&child.path, unsafe.Pointer(&childPath))
+			child.unlock()
+			return c.n
+		}
+	}
+	if capacity := shrunkCapacity(len(n.children), int(n.live)); capacity != 0 {
+		return unsafe.Pointer(n.resized(capacity))
+	}
+	return unsafe.Pointer(n)
+}
@@ -0,0 +1,271 @@
+package art
+
+import (
+	"bytes"
+	"encoding/binary"
+	"math/rand"
+	"sync"
+	"testing"
+)
+
+func Test_RowexTree(t *testing.T) {
+	r := &RowexTree[int]{}
+	s := &kvStore[int]{}
+	if _, exists := r.Get(nil); exists || r.Len() != 0 {
+		t.Errorf("A new RowexTree should be empty")
+	}
+	r.Delete([]byte{1})
+	keys := make([][]byte, 0, 1000)
+	for _, k := range [][]byte{nil, {1}, bytes.Repeat([]byte{2}, 60), append(bytes.Repeat([]byte{2}, 60), 1), bytes.Repeat([]byte{2}, 30)} {
+		keys = append(keys, k)
+	}
+	for i := 0; i < 1000; i++ {
+		keys = append(keys, rndKey())
+	}
+	for i, k := range keys {
+		r.Put(k, i)
+		s.put(kv(k, i))
+	}
+	checkRowexTree(t, r, s)
+	// overwrite some and delete others.
+	for i, k := range keys {
+		switch i % 3 {
+		case 0:
+			r.Delete(k)
+			s.delete(k)
+		case 1:
+			r.Put(k, -i)
+			s.put(kv(k, -i))
+		}
+	}
+	r.Delete([]byte{3, 3, 3})
+	r.Delete(bytes.Repeat([]byte{2}, 40))
+	checkRowexTree(t, r, s)
+	for _, k := range keys {
+		r.Delete(k)
+		s.delete(k)
+	}
+	checkRowexTree(t, r, s)
+	if root := (*rnode[int])(r.root); root.live != 0 || root.value != nil {
+		t.Errorf("The root should be empty once all the keys are deleted")
+	}
+}
+
+func checkRowexTree[V comparable](t *testing.T, r *RowexTree[V], s *kvStore[V]) {
+	t.Helper()
+	for _, e := range s.kvs {
+		if v, exists := r.Get(e.key); !exists || v != e.val {
+			t.Errorf("Get(%v) returned %v %t, expecting %v true", e.key, v, exists, e.val)
+		}
+	}
+	if r.Len() != len(s.kvs) {
+		t.Errorf("Len() returned %d, expecting %d", r.Len(), len(s.kvs))
+	}
+	exp := s.ordered()
+	i := 0
+	r.Walk(func(k []byte, v V) WalkState {
+		if i >= len(exp) || !bytes.Equal(k, exp[i].key) || v != exp[i].val {
+			t.Errorf("Walk returned unexpected key/value %v / %v at %d", k, v, i)
+		}
+		i++
+		return Continue
+	})
+	if i != len(exp) {
+		t.Errorf("Walk returned %d keys, expecting %d", i, len(exp))
+	}
+	if root := (*rnode[V])(r.root); root != nil {
+		checkRNodes(t, root)
+	}
+}
+
+// checkRNodes verifies that none of the nodes below n should have been shrunk.
+func checkRNodes[V any](t *testing.T, n *rnode[V]) {
+	t.Helper()
+	for _, c := range n.sortedChildren() {
+		if asRLeaf[V](c.n) != nil {
+			continue
+		}
+		child := (*rnode[V])(c.n)
+		if child.shrinkable() {
+			t.Errorf("Node at level %d with %d children should have been shrunk", child.level, child.live)
+		}
+		checkRNodes(t, child)
+	}
+}
+
+func Test_RowexTreeDeleteShrinksPath(t *testing.T) {
+	r := &RowexTree[int]{}
+	// the keys have more in common than fits in a path, so there's a chain of nodes for it.
+	a, b := append(bytes.Repeat([]byte{5}, 60), 1), append(bytes.Repeat([]byte{5}, 60), 2)
+	r.Put(a, 1)
+	r.Put(b, 2)
+	r.Delete(b)
+	s := &kvStore[int]{}
+	s.put(kv(a, 1))
+	checkRowexTree(t, r, s)
+	if c := (*rnode[int])(r.root).child(5); asRLeaf[int](c) == nil {
+		t.Errorf("The chain of nodes should have been replaced by the remaining leaf")
+	}
+}
+
+func Test_RowexTreeReaderDuringSplit(t *testing.T) {
+	r := &RowexTree[int]{}
+	k1, k2 := []byte{1, 2, 3, 4, 5, 1}, []byte{1, 2, 3, 4, 5, 2}
+	r.Put(k1, 1)
+	r.Put(k2, 2)
+	// n has the path 2 3 4 5
+	n := (*rnode[int])((*rnode[int])(r.root).child(1))
+	get := func(when string, depth int) {
+		t.Helper()
+		if v, exists := n.get(k1, depth); !exists || v != 1 {
+			t.Errorf("%s get(%v) returned %v %t, expecting 1 true", when, k1, v, exists)
+		}
+		if _, exists := n.get([]byte{1, 2, 7, 4, 5, 1}, depth); exists {
+			t.Errorf("%s get() found a key that's not in the tree", when)
+		}
+	}
+	// a reader that gets to n from the node added by the split, before n's path is trimmed.
+	get("untrimmed", 3)
+	r.Put([]byte{1, 2, 9}, 3)
+	if p := n.loadPath().asSlice(); !bytes.Equal(p, []byte{4, 5}) {
+		t.Fatalf("n's path should have been trimmed to [4 5], but is %v", p)
+	}
+	// a reader that got to n before the split.
+	get("trimmed", 1)
+	get("after split", 3)
+	// removing the key that caused the split, merges the split node's path back into n.
+	r.Delete([]byte{1, 2, 9})
+	if p := n.loadPath().asSlice(); !bytes.Equal(p, []byte{2, 3, 4, 5}) {
+		t.Fatalf("n's path should have been extended to [2 3 4 5], but is %v", p)
+	}
+	get("merged", 3)
+	get("after merge", 1)
+}
+
+func Test_RowexTreeConcurrentReaders(t *testing.T) {
+	r := &RowexTree[int]{}
+	key := func(i int) []byte {
+		k := make([]byte, 4)
+		binary.BigEndian.PutUint32(k, uint32(i))
+		return k
+	}
+	// the even keys are never changed, so should always be found by the readers, while the
+	// writer adds and removes keys around them, causing splits, growing and shrinking.
+	const count = 1000
+	for i := 0; i < count; i += 2 {
+		r.Put(key(i), i)
+	}
+	stop := make(chan struct{})
+	wg := sync.WaitGroup{}
+	for g := 0; g < 4; g++ {
+		wg.Add(1)
+		go func(g int) {
+			defer wg.Done()
+			for i := g; ; i++ {
+				select {
+				case <-stop:
+					return
+				default:
+				}
+				k := i % count &^ 1
+				if v, exists := r.Get(key(k)); !exists || v != k {
+					t.Errorf("Get(%v) returned %v %t, expecting %v true", key(k), v, exists, k)
+					return
+				}
+				if i%100 == 0 {
+					var prev []byte
+					found := 0
+					r.Walk(func(k []byte, v int) WalkState {
+						if prev != nil && bytes.Compare(prev, k) >= 0 {
+							t.Errorf("Walk returned key %v after %v", k, prev)
+						}
+						if len(k) == 4 && binary.BigEndian.Uint32(k)%2 == 0 {
+							found++
+						}
+						prev = append(prev[:0], k...)
+						return Continue
+					})
+					if found != count/2 {
+						t.Errorf("Walk returned %d of the unchanged keys, expecting %d", found, count/2)
+					}
+				}
+			}
+		}(g)
+	}
+	rnd := rand.New(rand.NewSource(42))
+	churn := func() []byte {
+		k := key(rnd.Intn(count) | 1)
+		switch rnd.Intn(3) {
+		case 0:
+			// differs from the unchanged keys in the second byte, which splits the path
+			// that they share.
+			k[1] = byte(rnd.Intn(4))
+		case 1:
+			// an unchanged key followed by more bytes.
+			k[3] &^= 1
+			k = append(k, bytes.Repeat([]byte{byte(rnd.Intn(4))}, rnd.Intn(30)+1)...)
+		}
+		return k
+	}
+	for i := 0; i < 20000; i++ {
+		r.Put(churn(), -1)
+		r.Delete(churn())
+	}
+	close(stop)
+	wg.Wait()
+}
+
+func Test_RowexTreeConcurrentWriters(t *testing.T) {
+	r := &RowexTree[int]{}
+	const writers = 4
+	stores := make([]kvStore[int], writers)
+	wg := sync.WaitGroup{}
+	for w := 0; w < writers; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			rnd := rand.New(rand.NewSource(int64(w)))
+			s := &stores[w]
+			// the keys are from a small alphabet so that the writers share nodes, the last byte
+			// is the writer, so that each writer has its own keys.
+			key := func() []byte {
+				k := make([]byte, rnd.Intn(8))
+				for i := range k {
+					k[i] = byte(rnd.Intn(3))
+				}
+				return append(k, byte(w))
+			}
+			for i := 0; i < 3000; i++ {
+				k := key()
+				if rnd.Intn(3) == 0 {
+					r.Delete(k)
+					s.delete(k)
+				} else {
+					r.Put(k, i)
+					s.put(kv(k, i))
+				}
+			}
+		}(w)
+	}
+	wg.Wait()
+	all := &kvStore[int]{}
+	for _, s := range stores {
+		all.kvs = append(all.kvs, s.kvs...)
+	}
+	checkRowexTree(t, r, all)
+	// delete everything concurrently
+	for w := 0; w < writers; w++ {
+		wg.Add(1)
+		go func(s *kvStore[int]) {
+			defer wg.Done()
+			for _, e := range s.kvs {
+				r.Delete(e.key)
+			}
+		}(&stores[w])
+	}
+	wg.Wait()
+	checkRowexTree(t, r, &kvStore[int]{})
+	if root := (*rnode[int])(r.root); root.live != 0 || root.value != nil {
+		t.Errorf("The root should be empty once all the keys are deleted")
+	}
+}
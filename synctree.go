@@ -0,0 +1,86 @@
+package art
+
+import "sync"
+
+// SyncTree wraps a Tree with a sync.RWMutex so that it's safe for concurrent use by multiple
+// goroutines. Put and Delete hold the write lock, while the read operations hold the read lock.
+//
+// The callbacks for Walk and WalkRange are called while the read lock is held. They must not call
+// any methods on the SyncTree, doing so will deadlock if there's a writer waiting for the lock.
+// Long walks also block writers for their duration. Use Snapshot to walk the tree without holding
+// the lock, in which case the callback is free to modify the tree.
+//
+// The zero value is an empty tree ready to use.
+type SyncTree[V any] struct {
+	lock sync.RWMutex
+	tree Tree[V]
+}
+
+// Put inserts or updates a value in the tree associated with the provided key.
+func (s *SyncTree[V]) Put(key []byte, value V) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.tree.Put(key, value)
+}
+
+// Delete removes the value associated with the supplied key if it exists.
+func (s *SyncTree[V]) Delete(key []byte) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.tree.Delete(key)
+}
+
+// Get the value for the provided key. exists is true if the key contains a value in the tree,
+// false otherwise.
+func (s *SyncTree[V]) Get(key []byte) (value V, exists bool) {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+	return s.tree.Get(key)
+}
+
+// Len returns the number of keys in the tree.
+func (s *SyncTree[V]) Len() int {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+	return s.tree.Len()
+}
+
+// Stats returns current statistics about the nodes & keys in the tree.
+func (s *SyncTree[V]) Stats() *Stats {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+	return s.tree.Stats()
+}
+
+// Walk will call the provided callback function with each key/value pair, in key order. The
+// callback is called with the read lock held, and must not call any methods on the SyncTree.
+func (s *SyncTree[V]) Walk(callback func(key []byte, value V) WalkState) {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+	s.tree.Walk(callback)
+}
+
+// WalkRange will call the provided callback function with each key/value pair in the range, in
+// key order. See Tree.WalkRange for details of the range. The callback is called with the read
+// lock held, and must not call any methods on the SyncTree.
+func (s *SyncTree[V]) WalkRange(start []byte, end []byte, callback func(key []byte, value V) WalkState) {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+	s.tree.WalkRange(start, end, callback)
+}
+
+// Snapshot returns a read only view of the tree as it is now. This takes the write lock, but only
+// briefly, as taking the snapshot is O(1). The returned tree can then be walked or iterated without
+// holding any locks, while the SyncTree continues to be modified.
+//
+//	snap := tree.Snapshot()
+//	snap.Walk(func(k []byte, v string) art.WalkState {
+//		tree.Delete(k) // fine, as the lock isn't held
+//		return art.Continue
+//	})
+func (s *SyncTree[V]) Snapshot() *PersistentTree[V] {
+	// taking a snapshot changes the tree's generation, so needs the write lock.
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return s.tree.Snapshot()
+}
@@ -0,0 +1,92 @@
+package art
+
+import (
+	"encoding/binary"
+	"sync"
+	"testing"
+)
+
+func Test_SyncTree(t *testing.T) {
+	st := &SyncTree[int]{}
+	key := func(w, i int) []byte {
+		k := make([]byte, 5)
+		k[0] = byte(w)
+		binary.BigEndian.PutUint32(k[1:], uint32(i))
+		return k
+	}
+	const writers = 4
+	const count = 1000
+	wg := sync.WaitGroup{}
+	for w := 0; w < writers; w++ {
+		wg.Add(2)
+		go func(w int) {
+			defer wg.Done()
+			for i := 0; i < count; i++ {
+				st.Put(key(w, i), i)
+			}
+			for i := 0; i < count; i += 2 {
+				st.Delete(key(w, i))
+			}
+		}(w)
+		go func(w int) {
+			defer wg.Done()
+			for i := 0; i < count; i++ {
+				if v, exists := st.Get(key(w, i)); exists && v != i {
+					t.Errorf("Get(%v) returned unexpected value %d", key(w, i), v)
+				}
+				st.WalkRange(key(w, 0), key(w+1, 0), func(k []byte, v int) WalkState {
+					if int(binary.BigEndian.Uint32(k[1:])) != v {
+						t.Errorf("WalkRange returned unexpected key/value %v / %v", k, v)
+					}
+					return Continue
+				})
+				st.Len()
+				st.Stats()
+			}
+		}(w)
+	}
+	wg.Wait()
+
+	s := &kvStore[int]{}
+	for w := 0; w < writers; w++ {
+		for i := 1; i < count; i += 2 {
+			s.kvs = append(s.kvs, kv(key(w, i), i))
+		}
+	}
+	hasKeyVals(t, &st.tree, s.ordered())
+	if st.Stats().Keys != len(s.kvs) {
+		t.Errorf("Stats() reports %d keys, but expecting %d", st.Stats().Keys, len(s.kvs))
+	}
+	n := 0
+	st.Walk(func(k []byte, v int) WalkState {
+		n++
+		return Continue
+	})
+	if n != len(s.kvs) {
+		t.Errorf("Walk visited %d keys, but expecting %d", n, len(s.kvs))
+	}
+}
+
+func Test_SyncTreeSnapshotWalk(t *testing.T) {
+	st := &SyncTree[int]{}
+	for i := 0; i < 100; i++ {
+		st.Put([]byte{byte(i)}, i)
+	}
+	// modifying the tree during a walk of a snapshot doesn't deadlock, and doesn't affect the walk.
+	n := 0
+	st.Snapshot().Walk(func(k []byte, v int) WalkState {
+		st.Delete(k)
+		st.Put([]byte{byte(v), 1}, v)
+		n++
+		return Continue
+	})
+	if n != 100 {
+		t.Errorf("Snapshot walk visited %d keys, but expecting 100", n)
+	}
+	if st.Len() != 100 {
+		t.Errorf("Len() returned %d, but expecting 100", st.Len())
+	}
+	if _, exists := st.Get([]byte{5}); exists {
+		t.Errorf("Key [5] should have been deleted")
+	}
+}
@@ -0,0 +1,137 @@
+package art
+
+import "errors"
+
+var (
+	// ErrTxnDone is returned by Txn.Commit if the transaction has already been committed or rolled back.
+	ErrTxnDone = errors.New("transaction has already been committed or rolled back")
+	// ErrTxnConflict is returned by Txn.Commit if a key that the transaction changed has also been
+	// changed in the tree since the transaction started.
+	ErrTxnConflict = errors.New("transaction conflicts with a change made to the tree since it started")
+)
+
+// Txn is a set of changes to a Tree that are applied all together by Commit, or discarded
+// by Rollback. Reads from the Txn see the tree as it was when the Txn was started, with the
+// Txn's own changes applied on top. Changes made directly to the tree after Begin are not
+// visible to the Txn, and if they're to the same keys as the Txn, Commit fails with
+// ErrTxnConflict rather than overwriting them.
+//
+// A Txn is not safe for concurrent use, but the tree can be read & modified while the Txn is
+// in progress.
+//
+//	txn := tree.Begin()
+//	defer txn.Rollback()
+//	txn.Put([]byte("a"), "alice")
+//	txn.Delete([]byte("b"))
+//	return txn.Commit()
+type Txn[V any] struct {
+	base *Tree[V]
+	// start is a copy of base when the Txn started, which is used to find conflicting changes.
+	start Tree[V]
+	// view is start with the Txn's changes applied to it, it shares nodes with the base tree
+	// in the same way as a Snapshot does.
+	view Tree[V]
+	ops  Batch[V]
+	// the generation that base had before Begin, and the one that Begin gave it.
+	prevGen, gen uint64
+	done         bool
+}
+
+// Begin starts a new transaction. Starting a transaction is O(1), the tree isn't copied. While
+// the transaction is in progress, changes to the tree copy the nodes that they change, in the
+// same way as after a Snapshot.
+func (a *Tree[V]) Begin() *Txn[V] {
+	t := &Txn[V]{base: a, start: *a, view: *a, prevGen: a.gen}
+	t.view.gen = nextGeneration()
+	a.gen = nextGeneration()
+	t.gen = a.gen
+	return t
+}
+
+// Put stores value for key in the transaction. It panics if the transaction has been
+// committed or rolled back.
+func (t *Txn[V]) Put(key []byte, value V) {
+	t.checkNotDone()
+	t.view.Put(key, value)
+	t.ops.Put(key, value)
+}
+
+// Delete removes key in the transaction. It panics if the transaction has been
+// committed or rolled back.
+func (t *Txn[V]) Delete(key []byte) {
+	t.checkNotDone()
+	t.view.Delete(key)
+	t.ops.Delete(key)
+}
+
+func (t *Txn[V]) checkNotDone() {
+	if t.done {
+		panic(ErrTxnDone)
+	}
+}
+
+// Get the value for the provided key, including any changes made by the transaction.
+func (t *Txn[V]) Get(key []byte) (value V, exists bool) {
+	return t.view.Get(key)
+}
+
+// Len returns the number of keys in the tree, including any changes made by the transaction.
+func (t *Txn[V]) Len() int {
+	return t.view.Len()
+}
+
+// Walk will call the provided callback function with each key/value pair, in key order,
+// including any changes made by the transaction. See Tree.Walk for more details.
+func (t *Txn[V]) Walk(callback func(key []byte, value V) WalkState) {
+	t.view.Walk(callback)
+}
+
+// WalkRange will call the provided callback function with each key/value pair in the range, in
+// key order, including any changes made by the transaction. See Tree.WalkRange for more details.
+func (t *Txn[V]) WalkRange(start []byte, end []byte, callback func(key []byte, value V) WalkState) {
+	t.view.WalkRange(start, end, callback)
+}
+
+// Commit applies all the changes made in the transaction to the tree. It returns ErrTxnDone
+// if the transaction has already been committed or rolled back. If any of the keys that the
+// transaction changed have also been changed in the tree since the transaction started, none
+// of the changes are applied and it returns ErrTxnConflict. The transaction is finished either
+// way, so a conflicting transaction has to be started again.
+func (t *Txn[V]) Commit() error {
+	if t.done {
+		return ErrTxnDone
+	}
+	defer t.finish()
+	if t.base.root == t.start.root {
+		// the tree hasn't changed, so the view is the result of applying the changes to it.
+		t.base.root, t.base.size = t.view.root, t.view.size
+		return nil
+	}
+	for _, op := range t.ops.ops {
+		// the tree copies any leaf that it changes, so a different leaf means a different value.
+		if t.base.getLeaf(op.key) != t.start.getLeaf(op.key) {
+			return ErrTxnConflict
+		}
+	}
+	t.base.Apply(&t.ops)
+	return nil
+}
+
+// Rollback discards all the changes made in the transaction. Its okay to call Rollback
+// on a transaction that has already been committed, in which case it does nothing.
+func (t *Txn[V]) Rollback() {
+	t.finish()
+}
+
+func (t *Txn[V]) finish() {
+	if t.base != nil && t.base.gen == t.gen {
+		// no other tree shares the nodes of the generation the tree had before Begin now that the
+		// view is gone, so the tree can go back to changing them in place.
+		t.base.gen = t.prevGen
+	}
+	t.done = true
+	t.base = nil
+	t.start = Tree[V]{}
+	t.view = Tree[V]{}
+	t.ops = Batch[V]{}
+}
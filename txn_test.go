@@ -0,0 +1,168 @@
+package art
+
+import (
+	"fmt"
+	"testing"
+)
+
+func Test_TxnCommit(t *testing.T) {
+	a := new(Tree[string])
+	s := &kvStore[string]{}
+	for i := 0; i < 200; i++ {
+		e := kv([]byte(fmt.Sprintf("key%03d", i)), "v")
+		a.Put(e.key, e.val)
+		s.put(e)
+	}
+	before := append([]keyVal[string](nil), s.ordered()...)
+
+	txn := a.Begin()
+	defer txn.Rollback()
+	for i := 0; i < 200; i += 3 {
+		k := []byte(fmt.Sprintf("key%03d", i))
+		txn.Delete(k)
+		s.delete(k)
+	}
+	for i := 150; i < 250; i += 2 {
+		e := kv([]byte(fmt.Sprintf("key%03d", i)), "txn")
+		txn.Put(e.key, e.val)
+		s.put(e)
+	}
+	// the txn sees its own writes, the tree doesn't
+	hasKeyVals(t, &txn.view, s.ordered())
+	if txn.Len() != len(s.kvs) {
+		t.Errorf("Txn Len() was %d, but expecting %d", txn.Len(), len(s.kvs))
+	}
+	if v, exists := txn.Get([]byte("key150")); !exists || v != "txn" {
+		t.Errorf("Txn Get() returned %v %t, expecting txn true", v, exists)
+	}
+	if _, exists := txn.Get([]byte("key003")); exists {
+		t.Errorf("Txn Get() returned a value for a key deleted in the txn")
+	}
+	hasKeyVals(t, a, before)
+
+	if err := txn.Commit(); err != nil {
+		t.Fatalf("Commit returned unexpected error %v", err)
+	}
+	hasKeyVals(t, a, s.ordered())
+	if err := txn.Commit(); err != ErrTxnDone {
+		t.Errorf("Second Commit should return ErrTxnDone, but got %v", err)
+	}
+}
+
+func Test_TxnRollback(t *testing.T) {
+	a := new(Tree[int])
+	a.Put([]byte{1}, 1)
+	a.Put([]byte{2}, 2)
+	before := pretty(a)
+
+	txn := a.Begin()
+	txn.Put([]byte{1}, 10)
+	txn.Put([]byte{3}, 3)
+	txn.Delete([]byte{2})
+	txn.Rollback()
+	if after := pretty(a); after != before {
+		t.Errorf("Rollback should leave the tree unchanged, was\n%s\nnow\n%s", before, after)
+	}
+	if err := txn.Commit(); err != ErrTxnDone {
+		t.Errorf("Commit after Rollback should return ErrTxnDone, but got %v", err)
+	}
+	defer func() {
+		if r := recover(); r != ErrTxnDone {
+			t.Errorf("Put after Rollback should panic with ErrTxnDone, but got %v", r)
+		}
+	}()
+	txn.Put([]byte{4}, 4)
+}
+
+func Test_TxnConcurrentChanges(t *testing.T) {
+	a := new(Tree[int])
+	a.Put([]byte{1}, 1)
+	a.Put([]byte{2}, 2)
+	txn := a.Begin()
+	txn.Put([]byte{1}, 10)
+	txn.Walk(func(k []byte, v int) WalkState {
+		// changes to the tree made during the txn aren't visible to it.
+		a.Put([]byte{3}, 3)
+		a.Put([]byte{2}, 20)
+		return Continue
+	})
+	hasKeyVals(t, &txn.view, []keyVal[int]{kv([]byte{1}, 10), kv([]byte{2}, 2)})
+	if err := txn.Commit(); err != nil {
+		t.Fatalf("Commit returned unexpected error %v", err)
+	}
+	hasKeyVals(t, a, []keyVal[int]{kv([]byte{1}, 10), kv([]byte{2}, 20), kv([]byte{3}, 3)})
+}
+
+func Test_TxnConflict(t *testing.T) {
+	for _, change := range []func(a *Tree[int]){
+		func(a *Tree[int]) { a.Put([]byte{1}, 10) },
+		func(a *Tree[int]) { a.Put([]byte{1}, 1) },
+		func(a *Tree[int]) { a.Delete([]byte{1}) },
+		func(a *Tree[int]) { a.Put([]byte{3}, 3) },
+	} {
+		a := new(Tree[int])
+		a.Put([]byte{1}, 1)
+		a.Put([]byte{2}, 2)
+		txn := a.Begin()
+		txn.Put([]byte{1}, 100)
+		txn.Delete([]byte{3})
+		change(a)
+		s := &kvStore[int]{}
+		a.Walk(func(k []byte, v int) WalkState {
+			s.put(kv(append([]byte(nil), k...), v))
+			return Continue
+		})
+		if err := txn.Commit(); err != ErrTxnConflict {
+			t.Errorf("Commit should return ErrTxnConflict, but got %v", err)
+		}
+		// none of the txn's changes are applied
+		hasKeyVals(t, a, s.ordered())
+		if err := txn.Commit(); err != ErrTxnDone {
+			t.Errorf("Commit after a conflict should return ErrTxnDone, but got %v", err)
+		}
+	}
+}
+
+func Test_TxnCommitUnchangedTree(t *testing.T) {
+	a := new(Tree[int])
+	for i := 0; i < 100; i++ {
+		a.Put([]byte{byte(i)}, i)
+	}
+	txn := a.Begin()
+	txn.Put([]byte{1}, 10)
+	txn.Delete([]byte{2})
+	root := txn.view.root
+	if err := txn.Commit(); err != nil {
+		t.Fatalf("Commit returned unexpected error %v", err)
+	}
+	if a.root != root {
+		t.Errorf("Commit to an unchanged tree should use the transaction's nodes")
+	}
+	if v, _ := a.Get([]byte{1}); v != 10 || a.Len() != 99 {
+		t.Errorf("Tree has value %d and %d keys, expecting 10 and 99", v, a.Len())
+	}
+}
+
+func Test_TxnFinishedDoesntCopy(t *testing.T) {
+	a := new(Tree[int])
+	for i := 0; i < 100; i++ {
+		a.Put([]byte{byte(i), 1}, i)
+	}
+	k := []byte{5, 1}
+	for _, finish := range []func(*Txn[int]){
+		func(txn *Txn[int]) { txn.Rollback() },
+		func(txn *Txn[int]) { txn.Commit() },
+		func(txn *Txn[int]) {
+			// a change to the tree during the transaction copies the nodes it changes
+			a.Put(k, 5)
+			txn.Commit()
+		},
+	} {
+		txn := a.Begin()
+		txn.Put([]byte{200}, 1)
+		finish(txn)
+		if allocs := testing.AllocsPerRun(10, func() { a.Put(k, 5) }); allocs != 0 {
+			t.Errorf("Put to an existing key after the transaction finished made %v allocations, expecting 0", allocs)
+		}
+	}
+}
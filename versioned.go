@@ -0,0 +1,129 @@
+package art
+
+import "sort"
+
+// VersionedTree is a Tree that retains previous versions of itself. Each change made by Put or
+// Delete creates a new version, identified by a number that's one more than the previous version.
+// Every Put is a change, even one that stores the value the key already has, while a Delete of a
+// key that isn't in the tree isn't, so it doesn't create a version.
+// Any retained version can be read with GetAt and WalkAt. Versions share all the nodes that are
+// the same between them, so a version costs the nodes on the path from the root to the changed
+// key. Old versions are retained until they're removed by Compact.
+//
+// The zero value is an empty tree at version 0 ready to use. A VersionedTree is not safe for
+// concurrent use, however the trees returned by At can be read while the VersionedTree is modified.
+type VersionedTree[V any] struct {
+	// the latest version
+	tree    Tree[V]
+	version uint64
+	// the oldest version that hasn't been removed by Compact
+	oldest uint64
+	// the retained versions after version 0, in ascending version order. This includes the
+	// latest version.
+	versions []treeVersion[V]
+}
+
+type treeVersion[V any] struct {
+	version uint64
+	tree    Tree[V]
+}
+
+// Put stores value for key in a new version of the tree, and returns the new version. A new
+// version is created even if key already has value.
+func (t *VersionedTree[V]) Put(key []byte, value V) (version uint64) {
+	// the latest version is retained, so any nodes it has need copying rather than changing.
+	t.tree.gen = nextGeneration()
+	t.tree.Put(key, value)
+	return t.addVersion()
+}
+
+// Delete removes key in a new version of the tree, and returns the new version. If the key isn't
+// in the tree no version is created, deleted is false and the current version is returned.
+func (t *VersionedTree[V]) Delete(key []byte) (version uint64, deleted bool) {
+	if _, exists := t.tree.Get(key); !exists {
+		return t.version, false
+	}
+	t.tree.gen = nextGeneration()
+	t.tree.Delete(key)
+	return t.addVersion(), true
+}
+
+func (t *VersionedTree[V]) addVersion() uint64 {
+	t.version++
+	t.versions = append(t.versions, treeVersion[V]{version: t.version, tree: t.tree})
+	return t.version
+}
+
+// Version returns the latest version of the tree.
+func (t *VersionedTree[V]) Version() uint64 {
+	return t.version
+}
+
+// Get the value for the provided key from the latest version of the tree.
+func (t *VersionedTree[V]) Get(key []byte) (value V, exists bool) {
+	return t.tree.Get(key)
+}
+
+// Len returns the number of keys in the latest version of the tree.
+func (t *VersionedTree[V]) Len() int {
+	return t.tree.Len()
+}
+
+// At returns a read only view of the tree as it was at version. ok is false if the version has
+// been removed by Compact, or doesn't exist yet. The returned tree is unaffected by subsequent
+// changes.
+func (t *VersionedTree[V]) At(version uint64) (tree *PersistentTree[V], ok bool) {
+	if version < t.oldest || version > t.version {
+		return nil, false
+	}
+	idx := t.find(version)
+	if idx < 0 {
+		// version 0 is the empty tree
+		return &PersistentTree[V]{}, true
+	}
+	return &PersistentTree[V]{tree: t.versions[idx].tree}, true
+}
+
+// find returns the index into versions of the newest version that is equal to or older than
+// version, or -1 if there isn't one.
+func (t *VersionedTree[V]) find(version uint64) int {
+	return sort.Search(len(t.versions), func(i int) bool {
+		return t.versions[i].version > version
+	}) - 1
+}
+
+// GetAt returns the value for the provided key as it was at version. exists is false if the key
+// had no value at that version, or if the version has been removed by Compact.
+func (t *VersionedTree[V]) GetAt(key []byte, version uint64) (value V, exists bool) {
+	if tree, ok := t.At(version); ok {
+		return tree.Get(key)
+	}
+	return value, false
+}
+
+// WalkAt will call the provided callback function with each key/value pair as it was at version,
+// in key order. If the version has been removed by Compact the callback is not called.
+func (t *VersionedTree[V]) WalkAt(version uint64, callback func(key []byte, value V) WalkState) {
+	if tree, ok := t.At(version); ok {
+		tree.Walk(callback)
+	}
+}
+
+// Compact removes the versions before the supplied version, allowing the nodes that are only
+// used by them to be garbage collected. The supplied version and all later versions remain
+// available. The latest version is never removed.
+func (t *VersionedTree[V]) Compact(before uint64) {
+	if before > t.version {
+		before = t.version
+	}
+	if before <= t.oldest {
+		return
+	}
+	t.oldest = before
+	keep := t.find(before)
+	n := copy(t.versions, t.versions[keep:])
+	for i := n; i < len(t.versions); i++ {
+		t.versions[i] = treeVersion[V]{}
+	}
+	t.versions = t.versions[:n]
+}
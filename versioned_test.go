@@ -0,0 +1,133 @@
+package art
+
+import (
+	"bytes"
+	"math/rand"
+	"testing"
+)
+
+func Test_VersionedTree(t *testing.T) {
+	v := &VersionedTree[int]{}
+	s := &kvStore[int]{}
+	// the expected contents for each version
+	exp := [][]keyVal[int]{nil}
+	keys := make([][]byte, 0, 300)
+	for i := 0; i < 400; i++ {
+		if len(keys) > 0 && rand.Intn(4) == 0 {
+			k := keys[rand.Intn(len(keys))]
+			_, wasPresent := s.get(k)
+			version, deleted := v.Delete(k)
+			if deleted != wasPresent {
+				t.Errorf("Delete(%v) returned deleted %t, but expecting %t", k, deleted, wasPresent)
+			}
+			if !deleted {
+				if version != uint64(len(exp)-1) {
+					t.Errorf("Delete of missing key returned version %d, expecting %d", version, len(exp)-1)
+				}
+				continue
+			}
+			s.delete(k)
+		} else {
+			k := rndKey()
+			keys = append(keys, k)
+			v.Put(k, i)
+			s.put(kv(k, i))
+		}
+		exp = append(exp, append([]keyVal[int](nil), s.ordered()...))
+		if v.Version() != uint64(len(exp)-1) {
+			t.Fatalf("Version() is %d, but expecting %d", v.Version(), len(exp)-1)
+		}
+	}
+	checkVersions := func(from int) {
+		t.Helper()
+		for ver := from; ver < len(exp); ver += 7 {
+			tree, ok := v.At(uint64(ver))
+			if !ok {
+				t.Errorf("At(%d) should be available", ver)
+				continue
+			}
+			hasKeyVals(t, &tree.tree, exp[ver])
+			for _, e := range exp[ver] {
+				if val, exists := v.GetAt(e.key, uint64(ver)); !exists || val != e.val {
+					t.Errorf("GetAt(%v, %d) returned %v %t, expecting %v true", e.key, ver, val, exists, e.val)
+				}
+			}
+			i := 0
+			v.WalkAt(uint64(ver), func(k []byte, val int) WalkState {
+				if i >= len(exp[ver]) || !bytes.Equal(k, exp[ver][i].key) || val != exp[ver][i].val {
+					t.Errorf("WalkAt(%d) returned unexpected key/value %v / %v", ver, k, val)
+				}
+				i++
+				return Continue
+			})
+		}
+		hasKeyVals(t, &v.tree, exp[len(exp)-1])
+	}
+	checkVersions(0)
+	if _, ok := v.At(uint64(len(exp))); ok {
+		t.Errorf("At() for a version that doesn't exist yet should return false")
+	}
+
+	compactAt := len(exp) / 2
+	v.Compact(uint64(compactAt))
+	checkVersions(compactAt)
+	for _, ver := range []int{0, 1, compactAt - 1} {
+		if _, ok := v.At(uint64(ver)); ok {
+			t.Errorf("At(%d) should return false after Compact(%d)", ver, compactAt)
+		}
+		if len(exp[ver]) > 0 {
+			if _, exists := v.GetAt(exp[ver][0].key, uint64(ver)); exists {
+				t.Errorf("GetAt(%v, %d) should return false after Compact(%d)", exp[ver][0].key, ver, compactAt)
+			}
+		}
+	}
+	if len(v.versions) != len(exp)-compactAt {
+		t.Errorf("Expecting %d versions to be retained, but there are %d", len(exp)-compactAt, len(v.versions))
+	}
+
+	// compacting past the latest version keeps the latest version.
+	v.Compact(uint64(len(exp) + 10))
+	checkVersions(len(exp) - 1)
+	if len(v.versions) != 1 {
+		t.Errorf("Expecting only the latest version to be retained, but there are %d", len(v.versions))
+	}
+}
+
+func Test_VersionedTreeEmpty(t *testing.T) {
+	v := &VersionedTree[int]{}
+	if tree, ok := v.At(0); !ok || tree.Len() != 0 {
+		t.Errorf("Version 0 should be available and empty")
+	}
+	if _, deleted := v.Delete([]byte{1}); deleted {
+		t.Errorf("Delete on an empty tree shouldn't delete anything")
+	}
+	v.Put([]byte{1}, 1)
+	if _, exists := v.GetAt([]byte{1}, 0); exists {
+		t.Errorf("Key shouldn't exist at version 0")
+	}
+	if val, exists := v.GetAt([]byte{1}, 1); !exists || val != 1 {
+		t.Errorf("GetAt([1], 1) returned %v %t, expecting 1 true", val, exists)
+	}
+}
+
+func Test_VersionedTreeDeleteMissingKey(t *testing.T) {
+	v := &VersionedTree[int]{}
+	v.Put([]byte{1}, 1)
+	v.Put([]byte{2}, 2)
+	if version, deleted := v.Delete([]byte{3}); deleted || version != 2 {
+		t.Errorf("Delete of a missing key returned %d %t, expecting 2 false", version, deleted)
+	}
+	if v.Version() != 2 || len(v.versions) != 2 {
+		t.Errorf("Delete of a missing key shouldn't create a version, but the tree is at version %d with %d versions", v.Version(), len(v.versions))
+	}
+	// storing the same value is still a new version
+	if version := v.Put([]byte{1}, 1); version != 3 {
+		t.Errorf("Put of an unchanged value returned version %d, expecting 3", version)
+	}
+	if version, deleted := v.Delete([]byte{1}); !deleted || version != 4 {
+		t.Errorf("Delete returned %d %t, expecting 4 true", version, deleted)
+	}
+	if _, exists := v.GetAt([]byte{1}, 3); !exists {
+		t.Errorf("Key should still exist at version 3")
+	}
+}